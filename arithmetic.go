@@ -0,0 +1,188 @@
+package glisp
+
+import (
+    "math"
+)
+
+// numbers checks that every param is a number, so that arithmetic builtins
+// can report a type error instead of skipping the ones that aren't.
+func numbers(name string, params List) error {
+    for _, p := range params {
+        if !isNumber(p) {
+            return NewError(TYPE_ERROR, p, "%v expects numbers; found %v", name, Write(p))
+        }
+    }
+    return nil
+}
+
+func atLeast(name string, params List, n int) error {
+    if len(params) < n {
+        return errorAtCall(ARITY_ERROR, params, "%v requires at least %v parameters; you have %v - %v", name, n, len(params), Write(params))
+    }
+    return nil
+}
+
+func exactly(name string, params List, n int) error {
+    if len(params) != n {
+        return errorAtCall(ARITY_ERROR, params, "%v requires exactly %v parameters; you have %v - %v", name, n, len(params), Write(params))
+    }
+    return nil
+}
+
+func plus(_ *Scope, params List) (interface{}, error) {
+    if err := numbers("+", params); err != nil {
+        return nil, err
+    }
+    var sum interface{} = int64(0)
+    for _, p := range params {
+        sum = addNumbers(sum, p)
+    }
+    return sum, nil
+}
+
+func minus(_ *Scope, params List) (interface{}, error) {
+    if err := atLeast("-", params, 1); err != nil {
+        return nil, err
+    }
+    if err := numbers("-", params); err != nil {
+        return nil, err
+    }
+    if len(params) == 1 {
+        return subNumbers(int64(0), params[0]), nil
+    }
+    result := params[0]
+    for _, p := range params.Rest() {
+        result = subNumbers(result, p)
+    }
+    return result, nil
+}
+
+func times(_ *Scope, params List) (interface{}, error) {
+    if err := numbers("*", params); err != nil {
+        return nil, err
+    }
+    var product interface{} = int64(1)
+    for _, p := range params {
+        product = mulNumbers(product, p)
+    }
+    return product, nil
+}
+
+func divide(_ *Scope, params List) (interface{}, error) {
+    if err := atLeast("/", params, 1); err != nil {
+        return nil, err
+    }
+    if err := numbers("/", params); err != nil {
+        return nil, err
+    }
+    if len(params) == 1 {
+        params = List{int64(1), params[0]}
+    }
+    result := params[0]
+    for _, p := range params.Rest() {
+        if isExactZero(p) {
+            return nil, NewError(EVAL_ERROR, params, "Division by zero")
+        }
+        result = quoNumbers(result, p)
+    }
+    return result, nil
+}
+
+func integerDivision(name string, op func(a, b interface{}) interface{}) Function {
+    return Function(func(_ *Scope, params List) (interface{}, error) {
+        if err := exactly(name, params, 2); err != nil {
+            return nil, err
+        }
+        for _, p := range params {
+            if !isInteger(p) {
+                return nil, NewError(TYPE_ERROR, p, "%v expects integers; found %v", name, Write(p))
+            }
+        }
+        if isExactZero(params[1]) {
+            return nil, NewError(EVAL_ERROR, params, "Division by zero")
+        }
+        return op(params[0], params[1]), nil
+    })
+}
+
+// comparison builds a chained comparison like (< a b c), which holds when
+// every neighbouring pair does. NaN is unordered, so nothing holds for it.
+func comparison(name string, holds func(int) bool) Function {
+    return Function(func(_ *Scope, params List) (interface{}, error) {
+        if err := atLeast(name, params, 1); err != nil {
+            return nil, err
+        }
+        if err := numbers(name, params); err != nil {
+            return nil, err
+        }
+        for i, p := range params {
+            if isNaN(p) {
+                return false, nil
+            }
+            if i > 0 && !holds(compareNumbers(params[i-1], p)) {
+                return false, nil
+            }
+        }
+        return true, nil
+    })
+}
+
+// extreme picks the min or max of its params. As in Scheme, a single float
+// anywhere makes the answer a float, and a NaN anywhere makes it NaN.
+func extreme(name string, better func(int) bool) Function {
+    return Function(func(_ *Scope, params List) (interface{}, error) {
+        if err := atLeast(name, params, 1); err != nil {
+            return nil, err
+        }
+        if err := numbers(name, params); err != nil {
+            return nil, err
+        }
+        result, inexact := params[0], false
+        for _, p := range params {
+            if isNaN(p) {
+                return math.NaN(), nil
+            }
+            inexact = inexact || rank(p) == floatRank
+            if better(compareNumbers(p, result)) {
+                result = p
+            }
+        }
+        if inexact {
+            return toFloat(result), nil
+        }
+        return result, nil
+    })
+}
+
+func abs(_ *Scope, params List) (interface{}, error) {
+    if err := exactly("abs", params, 1); err != nil {
+        return nil, err
+    }
+    if err := numbers("abs", params); err != nil {
+        return nil, err
+    }
+    if compareNumbers(params[0], int64(0)) < 0 {
+        return subNumbers(int64(0), params[0]), nil
+    }
+    return params[0], nil
+}
+
+func arithmeticBuiltins() map[string]interface{} {
+    return map[string]interface{} {
+        "plus": Function(plus),
+        "+"   : Function(plus),
+        "-"   : Function(minus),
+        "*"   : Function(times),
+        "/"   : Function(divide),
+        "rem" : integerDivision("rem", remNumbers),
+        "mod" : integerDivision("mod", modNumbers),
+        "="   : comparison("=", func(c int) bool { return c == 0 }),
+        "<"   : comparison("<", func(c int) bool { return c < 0 }),
+        ">"   : comparison(">", func(c int) bool { return c > 0 }),
+        "<="  : comparison("<=", func(c int) bool { return c <= 0 }),
+        ">="  : comparison(">=", func(c int) bool { return c >= 0 }),
+        "min" : extreme("min", func(c int) bool { return c < 0 }),
+        "max" : extreme("max", func(c int) bool { return c > 0 }),
+        "abs" : Function(abs),
+    }
+}
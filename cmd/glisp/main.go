@@ -0,0 +1,111 @@
+// Command glisp runs glisp scripts, or starts an interactive REPL when it is
+// given no files.
+//
+//     glisp                 # REPL
+//     glisp script.glisp    # run a script
+package main
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/peterh/liner"
+    "github.com/tychofreeman/glisp"
+)
+
+const (
+    prompt = "glisp> "
+    continuationPrompt = "   ... "
+)
+
+func main() {
+    if len(os.Args) > 1 {
+        os.Exit(runFiles(os.Args[1:]))
+    }
+    repl()
+}
+
+func runFiles(fnames []string) int {
+    in := glisp.New()
+    for _, fname := range fnames {
+        if _, err := in.ProcessFile(fname); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            return 1
+        }
+    }
+    return 0
+}
+
+func historyFile() string {
+    home, err := os.UserHomeDir()
+    if err != nil {
+        return ""
+    }
+    return filepath.Join(home, ".glisp_history")
+}
+
+func repl() {
+    line := liner.NewLiner()
+    defer line.Close()
+    line.SetCtrlCAborts(true)
+
+    history := historyFile()
+    if f, err := os.Open(history); err == nil {
+        line.ReadHistory(f)
+        f.Close()
+    }
+    defer func() {
+        if f, err := os.Create(history); err == nil {
+            line.WriteHistory(f)
+            f.Close()
+        }
+    }()
+
+    in := glisp.New()
+    pending := ""
+    for {
+        p := prompt
+        if pending != "" {
+            p = continuationPrompt
+        }
+        input, err := line.Prompt(p)
+        if err == liner.ErrPromptAborted {
+            pending = ""
+            continue
+        } else if err == io.EOF {
+            fmt.Println()
+            return
+        } else if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            return
+        }
+
+        pending += input + "\n"
+        tokens, err := glisp.TokenizeString(pending)
+        if glisp.IsIncomplete(err) {
+            continue
+        }
+        source := strings.TrimSpace(pending)
+        pending = ""
+        if source != "" {
+            line.AppendHistory(strings.Replace(source, "\n", " ", -1))
+        }
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            continue
+        }
+        if len(tokens) == 0 {
+            continue
+        }
+
+        value, err := in.ProcessTokens(tokens)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            continue
+        }
+        fmt.Println(glisp.Write(value))
+    }
+}
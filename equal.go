@@ -0,0 +1,92 @@
+package glisp
+
+// identical is eq?. Symbols, booleans, nil, strings and numbers have no
+// identity apart from their value, so they are identical when Go's == says
+// they are. Lists are identical when they are the same list, not just a list
+// with the same elements, and procedures when they are the same procedure:
+// for builtins, the same entry in the builtin table.
+func identical(a, b Value) bool {
+    switch x := a.(type) {
+    case Symbol:
+        y, ok := b.(Symbol)
+        return ok && x == y
+    case List:
+        y, ok := b.(List)
+        return ok && len(x) == len(y) && (len(x) == 0 || &x[0] == &y[0])
+    case Function, NonEvaluatingFunction:
+        // Go can't compare funcs, and their code pointers are shared, so a
+        // bare one that Go code has handed in isn't identical to anything.
+        return false
+    }
+    return a == b
+}
+
+// eqv is eqv?: identical, except that numbers are the same when they have
+// the same value and are both exact or both inexact. (eqv? 2 2.0) is false.
+func eqv(a, b Value) bool {
+    if isNaN(a) || isNaN(b) {
+        return isNaN(a) && isNaN(b)
+    }
+    if isNumber(a) && isNumber(b) {
+        return (rank(a) == floatRank) == (rank(b) == floatRank) && compareNumbers(a, b) == 0
+    }
+    return identical(a, b)
+}
+
+// Equal is equal?: lists and pairs are equal when their elements are, all
+// the way down, and anything else when it is eqv?. Strings are equal when
+// they hold the same text. A List and a chain of Pairs ending in a List
+// can be equal, since they print the same.
+//
+// It keeps its own stack of what is left to compare rather than recursing,
+// and it remembers which pairs of cells it has started on. Circular lists,
+// which set-car! and set-cdr! can make, then come back to one of those
+// instead of going round forever; as in R7RS, they are equal if nothing
+// along the way differs.
+func Equal(a, b Value) bool {
+    type cells struct {
+        a, b interface{}
+    }
+    seen := map[cells]bool{}
+    todo := []Value{a, b}
+    for len(todo) > 0 {
+        a, b := todo[len(todo)-2], todo[len(todo)-1]
+        todo = todo[:len(todo)-2]
+        carA, cdrA, okA := split(a)
+        carB, cdrB, okB := split(b)
+        if !okA || !okB {
+            if !eqv(a, b) {
+                return false
+            }
+            continue
+        }
+        cellA, _ := cell(a)
+        cellB, _ := cell(b)
+        if seen[cells{cellA, cellB}] {
+            continue
+        }
+        seen[cells{cellA, cellB}] = true
+        todo = append(todo, cdrA, cdrB, carA, carB)
+    }
+    return true
+}
+
+func equality(name string, same func(a, b Value) bool) Function {
+    return func(_ *Scope, params List) (interface{}, error) {
+        if err := exactly(name, params, 2); err != nil {
+            return nil, err
+        }
+        return same(params[0], params[1]), nil
+    }
+}
+
+func equalityBuiltins() map[string]interface{} {
+    return map[string]interface{} {
+        "eq?"   : equality("eq?", identical),
+        "eqv?"  : equality("eqv?", eqv),
+        "equal?": equality("equal?", Equal),
+        // eq predates the others. It has always compared numbers by value,
+        // as eqv? does.
+        "eq"    : equality("eq", eqv),
+    }
+}
@@ -0,0 +1,66 @@
+package glisp
+
+import (
+    "testing"
+
+    . "github.com/tychofreeman/go-matchers"
+)
+
+func TestEqIsIdentity(t *testing.T) {
+    AssertThat(t, process(t, "(eq? 'a 'a)"), IsTrue)
+    AssertThat(t, process(t, "(eq? '() '())"), IsTrue)
+    AssertThat(t, process(t, "(eq? nil nil)"), IsTrue)
+    AssertThat(t, process(t, "(eq? 5 5)"), IsTrue)
+    AssertThat(t, process(t, "(let ((xs '(1 2))) (eq? xs xs))"), IsTrue)
+    AssertThat(t, process(t, "(eq? '(1 2) '(1 2))"), IsFalse)
+    AssertThat(t, process(t, "(eq? car car)"), IsTrue)
+    AssertThat(t, process(t, "(eq? car cdr)"), IsFalse)
+    AssertThat(t, process(t, "(let ((f (lambda (x) x))) (eq? f f))"), IsTrue)
+    AssertThat(t, process(t, "(eq? (lambda (x) x) (lambda (x) x))"), IsFalse)
+}
+
+func TestDistinctBuiltinsAreNotEq(t *testing.T) {
+    AssertThat(t, process(t, "(eq? < >)"), IsFalse)
+    AssertThat(t, process(t, "(eq? min max)"), IsFalse)
+    AssertThat(t, process(t, "(eq? eq? equal?)"), IsFalse)
+    AssertThat(t, process(t, "(eq? < <)"), IsTrue)
+    AssertThat(t, process(t, "(member > (list < =))"), IsFalse)
+    AssertThat(t, process(t, "(let ((less <)) (eq? less <))"), IsTrue)
+}
+
+func TestEqvComparesNumbersOfTheSameExactness(t *testing.T) {
+    AssertThat(t, process(t, "(eqv? 100000000000000000000 100000000000000000000)"), IsTrue)
+    AssertThat(t, process(t, "(eqv? 1/2 2/4)"), IsTrue)
+    AssertThat(t, process(t, "(eqv? 1.5 1.5)"), IsTrue)
+    AssertThat(t, process(t, "(eqv? 2 2.0)"), IsFalse)
+    AssertThat(t, process(t, "(eqv? 2 \"2\")"), IsFalse)
+    AssertThat(t, process(t, "(eqv? '(1) '(1))"), IsFalse)
+}
+
+func TestEqualComparesStructure(t *testing.T) {
+    AssertThat(t, process(t, "(let ((two 2)) (equal? '(1 (2 \"three\") ()) `(1 (,two \"three\") ())))"), IsTrue)
+    AssertThat(t, process(t, "(equal? '(1 2) '(1 2 3))"), IsFalse)
+    AssertThat(t, process(t, "(equal? '(1 2) '(1 2.0))"), IsFalse)
+    AssertThat(t, process(t, "(equal? \"abc\" \"abc\")"), IsTrue)
+    AssertThat(t, process(t, "(equal? '(a) 'a)"), IsFalse)
+}
+
+func TestComparingListsDoesNotPanic(t *testing.T) {
+    AssertThat(t, process(t, "(eq '(1) '(1))"), IsFalse)
+    AssertThat(t, process(t, "(eq? car '(1))"), IsFalse)
+}
+
+func TestEqualityPredicatesTakeTwoArguments(t *testing.T) {
+    AssertThat(t, processError(t, "(equal? 1)").Kind, Equals(ARITY_ERROR))
+    AssertThat(t, processError(t, "(eqv? 1 2 3)").Kind, Equals(ARITY_ERROR))
+}
+
+func TestEqualForEmbedders(t *testing.T) {
+    forms, err := TokenizeString(`(a "b" (1 1/2 2.5))`)
+    if err != nil {
+        t.Fatal(err)
+    }
+    AssertThat(t, Equal(forms[0], List{symbol("a"), "b", List{int64(1), process(t, "1/2"), 2.5}}), IsTrue)
+    AssertThat(t, Equal(List{}, List{}), IsTrue)
+    AssertThat(t, Equal(List{int64(1)}, int64(1)), IsFalse)
+}
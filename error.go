@@ -0,0 +1,88 @@
+package glisp
+
+import ( "fmt" )
+
+type ErrorKind int8
+const (
+    EVAL_ERROR ErrorKind = iota
+    TYPE_ERROR
+    ARITY_ERROR
+    UNBOUND_ERROR
+    CALL_ERROR
+    INTERNAL_ERROR
+    READ_ERROR
+    INCOMPLETE_ERROR
+)
+
+func (kind ErrorKind) String() string {
+    switch kind {
+    case TYPE_ERROR:
+        return "type error"
+    case ARITY_ERROR:
+        return "arity error"
+    case UNBOUND_ERROR:
+        return "unbound symbol"
+    case CALL_ERROR:
+        return "call error"
+    case INTERNAL_ERROR:
+        return "internal error"
+    case READ_ERROR:
+        return "read error"
+    case INCOMPLETE_ERROR:
+        return "incomplete input"
+    }
+    return "eval error"
+}
+
+// Error is what Process and friends return when a script fails. Form is the
+// expression that was being evaluated when things went wrong, if known, and
+// Pos is where that expression (or the call around it) appears in the source.
+type Error struct {
+    Kind ErrorKind
+    Message string
+    Form interface{}
+    Pos Pos
+}
+
+func (err *Error) Error() string {
+    if err.Pos.IsValid() {
+        return fmt.Sprintf("%v: %v: %v", err.Pos, err.Kind, err.Message)
+    }
+    return fmt.Sprintf("%v: %v", err.Kind, err.Message)
+}
+
+// NewError builds an *Error. Builtins return it rather than panicking.
+func NewError(kind ErrorKind, form interface{}, format string, args ...interface{}) *Error {
+    return &Error{kind, fmt.Sprintf(format, args...), form, PositionOf(form)}
+}
+
+// errorAtCall is NewError for a call that is wrong as a whole, say with the
+// wrong number of arguments. form is its arguments, but the error leaves
+// Pos unknown so that it is located at the call rather than at the first of
+// them.
+func errorAtCall(kind ErrorKind, form interface{}, format string, args ...interface{}) *Error {
+    err := NewError(kind, form, format, args...)
+    err.Pos = Pos{}
+    return err
+}
+
+// locate fills in a missing position on err from the form being evaluated,
+// so errors raised inside builtins still point at the offending call.
+func locate(err error, form interface{}) error {
+    return locateAt(err, PositionOf(form))
+}
+
+// locateAt fills in a missing position on err with pos, if that is known.
+func locateAt(err error, pos Pos) error {
+    if e, ok := err.(*Error); ok && !e.Pos.IsValid() && pos.IsValid() {
+        e.Pos = pos
+    }
+    return err
+}
+
+// IsIncomplete reports whether err means the input stopped in the middle of
+// a form, say with a ( still open. A REPL can read another line and retry.
+func IsIncomplete(err error) bool {
+    e, ok := err.(*Error)
+    return ok && e.Kind == INCOMPLETE_ERROR
+}
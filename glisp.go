@@ -1,257 +1,331 @@
 package glisp
 
 import (
-    "fmt"
-    "os"
+    "bytes"
+    "math/big"
 )
 
 type Valuable interface {
-    Eval(*Scope) interface{}
+    Eval(*Scope) (interface{}, error)
 }
 
 type ParamsList List
-type Function func(_ *Scope, params List) interface{}
-type NonEvaluatingFunction func(_ *Scope, params List) interface{}
+type Function func(_ *Scope, params List) (interface{}, error)
+type NonEvaluatingFunction func(_ *Scope, params List) (interface{}, error)
 
-func GetValue(scope *Scope, source interface{}) interface{} {
+// builtin is how a Function or NonEvaluatingFunction sits in an
+// Interpreter's builtin table. Go can't tell funcs apart - every closure
+// made from one func literal shares its code - so each builtin is given a
+// pointer of its own for eq? to compare, along with the name it is bound to.
+type builtin struct {
+    name string
+    fn interface{}
+}
+
+// GetValue evaluates source all the way down, following tail calls in a
+// loop rather than by recursing.
+func GetValue(scope *Scope, source interface{}) (interface{}, error) {
+    if err := scope.nest(source); err != nil {
+        return nil, err
+    }
+    defer scope.unnest()
+    for {
+        value, err := step(scope, source)
+        if err != nil {
+            return nil, err
+        }
+        tail, ok := value.(*tailCall)
+        if !ok {
+            return value, nil
+        }
+        scope, source = tail.scope, tail.form
+    }
+}
+
+func step(scope *Scope, source interface{}) (interface{}, error) {
     switch value := source.(type) {
-    case int64:
-        return value
+    case nil, bool, int64, *big.Int, *big.Rat, float64, Function, NonEvaluatingFunction, *builtin, *Closure:
+        return value, nil
     case string:
-        return value
+        return value, nil
     case List:
-        return value.Eval(scope)
+        return value.step(scope)
+    case *Pair:
+        // A chain of Pairs ending in a List is a proper list, and runs like
+        // one. Anything else is improper or circular, and can't be run.
+        list, err := elements("eval", value)
+        if err != nil {
+            return nil, NewError(EVAL_ERROR, value, "Cannot evaluate %v; it isn't a proper list", Write(value))
+        }
+        return list.step(scope)
     case Valuable:
         return value.Eval(scope)
     default:
-        panic(fmt.Sprintf("Couldn't find anything of type %T (%v)\n", value, value))
+        return nil, NewError(TYPE_ERROR, value, "Cannot evaluate %v", Write(value))
     }
-    return nil
 }
 
-func quote(_ *Scope, params List) interface{} {
+func quote(_ *Scope, params List) (interface{}, error) {
     if len(params) > 0 {
-        return params[0]
+        return params[0], nil
     }
-    panic(fmt.Sprintf("QUOTE takes exactly 1 argument; you have %v - %v\n", len(params), params))
+    return nil, errorAtCall(ARITY_ERROR, params, "QUOTE takes exactly 1 argument; you have %v - %v", len(params), Write(params))
 }
 
-func car(_ *Scope, params List) interface{} {
+// car and cdr work on Lists and Pairs alike. Anything else has neither, and
+// gives nil.
+func car(_ *Scope, params List) (interface{}, error) {
     if len(params) > 0 {
-        switch x := params[0].(type) {
-        case List:
-            if len(x) > 0 {
-                return x[0]
-            }
+        if head, _, ok := split(params[0]); ok {
+            return head, nil
         }
     }
-    return nil
+    return nil, nil
 }
 
-func cdr(_ *Scope, params List) interface{} {
+func cdr(_ *Scope, params List) (interface{}, error) {
     if len(params) > 0 {
-        switch x := params[0].(type) {
-        case List:
-            if len(x) > 0 {
-                return x.Rest()
-            }
+        if _, tail, ok := split(params[0]); ok {
+            return tail, nil
         }
     }
-    return nil
+    return nil, nil
 }
 
-func atom(_ *Scope, params List) interface{} {
+func atom(_ *Scope, params List) (interface{}, error) {
+    return isAtom(params), nil
+}
+
+func isAtom(params List) bool {
     if len(params) > 0 {
         switch params[0].(type) {
-        case List:
+        case List, *Pair:
             return false
         default:
             return true
         }
-    } else {
-        return false
-    }
-}
-
-func cons(_ *Scope, params List) interface{} {
-    if len(params) == 1 {
-        return params
-    } else if len(params) == 2 {
-        if atom(nil, params.Rest()) == true {
-            return params
-        } else {
-            switch x := params[1].(type) {
-            case List:
-                output := List{params[0]}
-                for _, i := range x {
-                    output = append(output, i)
-                }
-                return output
-            }
-        }
     }
-    return nil
+    return false
 }
 
-func plus(_ *Scope, params List) interface{} {
-    var sum int64 = 0
-    for _, p := range params {
-        switch x := p.(type) {
-        case int64:
-            sum = sum + x
-        }
+// cons onto a List makes a longer List, which copies rather than shares
+// the List; onto anything else it makes a Pair, so (cons 1 2) is (1 . 2),
+// not (1 2).
+func cons(_ *Scope, params List) (interface{}, error) {
+    if err := exactly("cons", params, 2); err != nil {
+        return nil, err
     }
-    return sum
+    return consOnto(params[0], params[1]), nil
 }
 
-func if_(scope *Scope, params List) interface{} {
+func if_(scope *Scope, params List) (interface{}, error) {
     if len(params) != 3 {
-        panic(fmt.Sprintf("IF requires 3 parts - conditional, true expression and false expression. You have %v parts - %v.", len(params), params))
+        return nil, errorAtCall(ARITY_ERROR, params, "IF requires 3 parts - conditional, true expression and false expression. You have %v parts - %v.", len(params), Write(params))
     }
-    if true == GetValue(scope, params[0]) {
-        return GetValue(scope, params[1])
+    cond, err := GetValue(scope, params[0])
+    if err != nil {
+        return nil, err
     }
-    return GetValue(scope, params[2])
-}
-
-func eq(_ *Scope, params List) interface{} {
-    if len(params) != 2 {
-        panic(fmt.Sprintf("EQ requires exactly 2 parameters; you have %v - %v", len(params), params))
+    if truthy(cond) {
+        return &tailCall{scope, params[1]}, nil
     }
-    return params[0] == params[1]
-}
-
-func apply(scope *Scope, params List) interface{} {
-    return GetValue(scope, params)
-}
-
-func define_(scope *Scope, params List) interface{} {
-    name := params.First().(Token).Str()
-    body := params.Rest().First()
-
-    scope.add(name, body)
-    return List{}
+    return &tailCall{scope, params[2]}, nil
 }
 
-func macro(scope *Scope, params List) interface{} {
-    name := params.First().(Token).Str()
-    body := params.Rest().First()
-    macroFn := NonEvaluatingFunction(func(macroScope *Scope, macroParams List) interface{} {
-        switch b := body.(type) {
-        case Function:
-            return b(macroScope, macroParams)
-        case NonEvaluatingFunction:
-            return b(macroScope, macroParams)
-        default:
-            panic(fmt.Sprintf("Could nt execute a function: %t %v\n%v\n", b, b, macroScope))
-            return nil
+// and and or short-circuit: each returns the value that decided the answer.
+func and(scope *Scope, params List) (interface{}, error) {
+    if len(params) == 0 {
+        return true, nil
+    }
+    for _, p := range params[:len(params)-1] {
+        value, err := GetValue(scope, p)
+        if err != nil || !truthy(value) {
+            return value, err
         }
-    })
-    scope.add(name, macroFn)
-    return List{}
+    }
+    return &tailCall{scope, params[len(params)-1]}, nil
 }
 
-func print(scope *Scope, params List) interface{} {
-    fmt.Printf("%v\n", params)
-    os.Stdout.Sync()
-    return List{}
+func or(scope *Scope, params List) (interface{}, error) {
+    if len(params) == 0 {
+        return false, nil
+    }
+    for _, p := range params[:len(params)-1] {
+        value, err := GetValue(scope, p)
+        if err != nil || truthy(value) {
+            return value, err
+        }
+    }
+    return &tailCall{scope, params[len(params)-1]}, nil
 }
 
-var builtins = map[string]interface{} {
-    "quote": NonEvaluatingFunction(quote),
-    "car"  : Function(car),
-    "cdr"  : Function(cdr),
-    "atom" : Function(atom),
-    "cons" : Function(cons),
-    "plus" : Function(plus),
-    "if"   : NonEvaluatingFunction(if_),
-    "eq"   : Function(eq),
-    "apply": Function(apply),
-    "def"  : NonEvaluatingFunction(define_),
-    "defmacro" : NonEvaluatingFunction(macro),
-    "p"    : Function(print),
+func not(_ *Scope, params List) (interface{}, error) {
+    if len(params) != 1 {
+        return nil, errorAtCall(ARITY_ERROR, params, "NOT requires exactly 1 parameter; you have %v - %v", len(params), Write(params))
+    }
+    return !truthy(params[0]), nil
 }
 
-func make_param_binding_fn(param_decls interface{}) (func(interface{}) map[string]interface{}) {
-    param_names := []string{}
-    switch x := param_decls.(type) {
-    case List:
-        for _, y := range x {
-            switch z := y.(type) {
-            case Token:
-                param_names = append(param_names, z.Str())
-            default:
-                param_names = append(param_names, "")
-            }
-        }
-    default:
-        panic(fmt.Sprintf("Cannot build param bindings with unknown declaration type %T (expected a List of symbols)\n", x))
-    }
-    return func(theParams interface{}) map[string]interface{} {
-        scope := map[string]interface{}{}
-        switch params := theParams.(type) {
-        case List:
-            for i := 0; i < len(param_names); i++ {
-                scope[param_names[i]] = params[i]
+// apply calls its first param with the rest. As in Scheme, a list in last
+// place is spread out, so (apply + 1 (quote (2 3))) is (+ 1 2 3). That
+// includes a list built from Pairs; an improper one is an error.
+func apply(scope *Scope, params List) (interface{}, error) {
+    if len(params) < 1 {
+        return nil, errorAtCall(ARITY_ERROR, params, "APPLY requires a function to call")
+    }
+    args := append(List{}, params[1:]...)
+    if len(args) > 0 {
+        switch last := args[len(args)-1].(type) {
+        case List, *Pair:
+            spread, err := elements("apply", last)
+            if err != nil {
+                return nil, err
             }
-        default:
-            panic(fmt.Sprintf("Cannot associate param names with values if values aren't in a List - found type %T\n", params))
+            args = append(args[:len(args)-1], spread...)
         }
-        return scope
     }
+    return callFunction(scope, params[0], args)
 }
 
-func Parse(source interface{}) interface{} {
-    switch node := source.(type) {
-    case NumberToken:
-        return node
-    case StringToken:
-        return node
-    case Symbol:
-        return node
-    case List:
-        if node.IsLambda() {
-            body := ParseMany(node.Rest().Rest())
-            param_binding_fn := make_param_binding_fn(node.Second())
-            return Function(func(scope *Scope, params List) interface{} {
-                param_bindings := param_binding_fn(params)
-                var lastElement interface{} = nil
-                for _, element := range body {
-                    lastElement = GetValue(&Scope{scope, param_bindings, false}, element)
-                }
-                return lastElement
-            })
-        }
-        x :=  ParseMany(node)
-        return x
+func defName(form string, params List) (Symbol, error) {
+    if len(params) != 2 {
+        return Symbol{}, errorAtCall(ARITY_ERROR, params, "%v requires a name and a body; you have %v parts - %v", form, len(params), Write(params))
     }
-    return source
+    name, ok := params.First().(Symbol)
+    if !ok {
+        return Symbol{}, NewError(TYPE_ERROR, params.First(), "%v expects a name as its first parameter - found %v", form, Write(params.First()))
+    }
+    return name, nil
 }
 
-func ParseMany(input List) List {
-    output := List{}
-    for _, i := range input {
-        output = append(output, Parse(i))
+// define_ binds a name in the scope it is evaluated in: the global scope at
+// top level, or the local one inside a lambda or let body, where it shadows
+// any outer binding of the same name. Defining a name again replaces it.
+func define_(scope *Scope, params List) (interface{}, error) {
+    name, err := defName("DEF", params)
+    if err != nil {
+        return nil, err
+    }
+    value, err := GetValue(scope, params.Rest().First())
+    if err != nil {
+        return nil, err
     }
+    if c, ok := value.(*Closure); ok && c.name == "" {
+        c.name = name.Str()
+    }
+    scope.add(name.key(), value)
+    return List{}, nil
+}
 
-    return List(output)
+// set changes the nearest existing binding of a name, wherever in the scope
+// chain it is, so a closure can update a variable it closed over. Unlike
+// def it never creates one.
+func set(scope *Scope, params List) (interface{}, error) {
+    name, err := defName("SET!", params)
+    if err != nil {
+        return nil, err
+    }
+    owner := scope.find(name.key())
+    if owner == nil {
+        return nil, NewError(UNBOUND_ERROR, params.First(), "Cannot set! %v; it has not been defined", name)
+    } else if owner.readOnly {
+        return nil, NewError(EVAL_ERROR, params.First(), "Cannot set! the builtin %v; use def to shadow it", name)
+    }
+    value, err := GetValue(scope, params.Rest().First())
+    if err != nil {
+        return nil, err
+    }
+    owner.add(name.key(), value)
+    return List{}, nil
 }
 
-var baseScope = &Scope{nil, builtins, false}
+// newBuiltins returns a fresh table of the builtin functions, so that every
+// Interpreter can change its own without touching anyone else's.
+func newBuiltins() map[string]interface{} {
+    table := map[string]interface{} {
+        "quote": NonEvaluatingFunction(quote),
+        "car"  : Function(car),
+        "cdr"  : Function(cdr),
+        "atom" : Function(atom),
+        "cons" : Function(cons),
+        "set-car!" : Function(setCar),
+        "set-cdr!" : Function(setCdr),
+        "if"   : NonEvaluatingFunction(if_),
+        "and"  : NonEvaluatingFunction(and),
+        "or"   : NonEvaluatingFunction(or),
+        "not"  : Function(not),
+        "apply": Function(apply),
+        "lambda": NonEvaluatingFunction(lambda),
+        "procedure-arity": Function(procedureArity),
+        "procedure-name": Function(procedureName),
+        "doc"  : Function(doc),
+        "begin": NonEvaluatingFunction(begin),
+        "let"  : NonEvaluatingFunction(let),
+        "let*" : NonEvaluatingFunction(letStar),
+        "letrec" : NonEvaluatingFunction(letrec),
+        "def"  : NonEvaluatingFunction(define_),
+        "define" : NonEvaluatingFunction(define_),
+        "set!" : NonEvaluatingFunction(set),
+        "defmacro" : NonEvaluatingFunction(defmacro),
+        "quasiquote" : NonEvaluatingFunction(quasiquote),
+        "macroexpand-1" : Function(macroexpand1),
+        "macroexpand" : Function(macroexpand),
+        "gensym": Function(gensym),
+    }
+    for name, fn := range arithmeticBuiltins() {
+        table[name] = fn
+    }
+    for name, fn := range equalityBuiltins() {
+        table[name] = fn
+    }
+    for name, fn := range listBuiltins() {
+        table[name] = fn
+    }
+    return table
+}
 
-func ProcessTokens(scope *Scope, tokenized List, includeStdLib bool) interface{} {
+// ProcessTokens macro-expands and evaluates already-tokenized source one
+// top-level form at a time, so a macro can be used by any form after the
+// one that defines it. It returns the value of the last form. Any panic escaping a
+// builtin is turned into an INTERNAL_ERROR so a bad script can't take the
+// embedding program down with it. A Go stack overflow can't be recovered
+// from, though, so the Interpreter's scopes also limit how deeply
+// evaluation nests; see WithMaxDepth.
+func ProcessTokens(scope *Scope, tokenized List, includeStdLib bool) (value interface{}, err error) {
+    defer func() {
+        if r := recover(); r != nil {
+            value, err = nil, NewError(INTERNAL_ERROR, tokenized, "%v", r)
+        }
+    }()
     if includeStdLib {
-        ProcessTokens(scope, TokenizeFile("/Users/cwfreeman/dev/go/src/glisp/stdlib.glisp"), false)
+        stdlibTokens, err := newTokenizer(bytes.NewReader(stdlib), "stdlib.glisp").tokenize()
+        if err != nil {
+            return nil, err
+        }
+        if _, err := ProcessTokens(scope, stdlibTokens, false); err != nil {
+            return nil, err
+        }
     }
-    parsed := ParseMany(tokenized)
-    value := GetValue(scope, parsed)
-    return value
+    for i, form := range tokenized {
+        expanded, err := expand(scope, nil, form)
+        if err == nil {
+            value, err = GetValue(scope, expanded)
+        }
+        if err != nil {
+            return nil, locateAt(err, PositionIn(tokenized, i))
+        }
+    }
+    return value, nil
 }
 
-func Process(input string)  interface{} {
-    return ProcessTokens(baseScope, TokenizeString(input), true)
+var defaultInterpreter = New()
+
+// Process evaluates input in a shared, package-wide Interpreter. Use New to
+// get one that nobody else can see.
+func Process(input string) (interface{}, error) {
+    return defaultInterpreter.Process(input)
 }
 
-func ProcessFile(fname string) interface{} {
-    return ProcessTokens(baseScope, TokenizeFile(fname), true)
+func ProcessFile(fname string) (interface{}, error) {
+    return defaultInterpreter.ProcessFile(fname)
 }
@@ -0,0 +1,193 @@
+package glisp
+
+import (
+    "bytes"
+    _ "embed"
+    "io"
+    "io/fs"
+    "io/ioutil"
+    "os"
+    "sync"
+)
+
+//go:embed stdlib.glisp
+var stdlib []byte
+
+// prelude is a named chunk of glisp source run before anything else.
+type prelude struct {
+    name string
+    read func() ([]byte, error)
+}
+
+// Interpreter is an isolated glisp environment. Each one owns its builtin
+// table and global scope, so a def in one never shows up in another. Calls
+// on a single Interpreter are serialized.
+type Interpreter struct {
+    mu sync.Mutex
+    builtins map[string]interface{}
+    global *Scope
+    preludes []prelude
+    loaded bool
+    loadErr error
+    out io.Writer
+    maxDepth int
+}
+
+type Option func(*Interpreter)
+
+// WithBuiltin adds (or replaces) a builtin, usually a Function or
+// NonEvaluatingFunction, in the new Interpreter.
+func WithBuiltin(name string, value interface{}) Option {
+    return func(in *Interpreter) {
+        in.builtins[name] = value
+    }
+}
+
+// WithOutput sends what write, display, newline and p print to w instead
+// of os.Stdout.
+func WithOutput(w io.Writer) Option {
+    return func(in *Interpreter) {
+        in.out = w
+    }
+}
+
+// DefaultMaxDepth is how deeply evaluation can nest, unless WithMaxDepth
+// says otherwise. Calls in tail position don't count.
+const DefaultMaxDepth = 10000
+
+// WithMaxDepth limits how deeply evaluation can nest. Going deeper is an
+// EVAL_ERROR, which keeps a runaway recursive script from overflowing the
+// Go stack and taking the whole program down with it.
+func WithMaxDepth(n int) Option {
+    return func(in *Interpreter) {
+        in.maxDepth = n
+    }
+}
+
+// WithoutStdLib skips the bundled stdlib.glisp. Preludes added with
+// WithPrelude or WithPreludeFS still run.
+func WithoutStdLib() Option {
+    return func(in *Interpreter) {
+        if len(in.preludes) > 0 && in.preludes[0].name == "stdlib.glisp" {
+            in.preludes = in.preludes[1:]
+        }
+    }
+}
+
+// WithPrelude runs the named files, in order, after the stdlib and before
+// the first thing the Interpreter is asked to process.
+func WithPrelude(fnames ...string) Option {
+    return func(in *Interpreter) {
+        for _, fname := range fnames {
+            fname := fname
+            in.preludes = append(in.preludes, prelude{fname, func() ([]byte, error) {
+                return ioutil.ReadFile(fname)
+            }})
+        }
+    }
+}
+
+// WithPreludeFS is WithPrelude for files in fsys.
+func WithPreludeFS(fsys fs.FS, names ...string) Option {
+    return func(in *Interpreter) {
+        for _, name := range names {
+            name := name
+            in.preludes = append(in.preludes, prelude{name, func() ([]byte, error) {
+                return fs.ReadFile(fsys, name)
+            }})
+        }
+    }
+}
+
+func New(opts ...Option) *Interpreter {
+    in := &Interpreter{builtins: newBuiltins(), out: os.Stdout, maxDepth: DefaultMaxDepth}
+    for name, fn := range outputBuiltins(func() io.Writer { return in.out }) {
+        in.builtins[name] = fn
+    }
+    in.preludes = []prelude{{"stdlib.glisp", func() ([]byte, error) {
+        return stdlib, nil
+    }}}
+    for _, opt := range opts {
+        opt(in)
+    }
+    for name, value := range in.builtins {
+        switch value.(type) {
+        case Function, NonEvaluatingFunction:
+            in.builtins[name] = &builtin{name, value}
+        }
+    }
+    depth := &evalDepth{0, in.maxDepth}
+    in.global = &Scope{&Scope{nil, in.builtins, true, depth}, map[string]interface{}{}, false, depth}
+    return in
+}
+
+// load runs the preludes the first time the Interpreter is used. A failing
+// prelude makes every later call fail the same way.
+func (in *Interpreter) load() error {
+    if in.loaded {
+        return in.loadErr
+    }
+    in.loaded = true
+    for _, p := range in.preludes {
+        source, err := p.read()
+        if err != nil {
+            in.loadErr = err
+            break
+        }
+        tokens, err := newTokenizer(bytes.NewReader(source), p.name).tokenize()
+        if err != nil {
+            in.loadErr = err
+            break
+        }
+        if _, err := ProcessTokens(in.global, tokens, false); err != nil {
+            in.loadErr = err
+            break
+        }
+    }
+    return in.loadErr
+}
+
+func (in *Interpreter) ProcessTokens(tokenized List) (interface{}, error) {
+    in.mu.Lock()
+    defer in.mu.Unlock()
+    if err := in.load(); err != nil {
+        return nil, err
+    }
+    return ProcessTokens(in.global, tokenized, false)
+}
+
+func (in *Interpreter) Process(input string) (interface{}, error) {
+    tokens, err := TokenizeString(input)
+    if err != nil {
+        return nil, err
+    }
+    return in.ProcessTokens(tokens)
+}
+
+// ProcessFile evaluates a file form by form as it is read.
+func (in *Interpreter) ProcessFile(fname string) (interface{}, error) {
+    f, err := os.Open(fname)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    return in.ProcessReader(NewReader(f, fname))
+}
+
+// ProcessReader evaluates each form from r as soon as it has been read, and
+// returns the value of the last one. Forms before a read error have already
+// been evaluated when it is returned.
+func (in *Interpreter) ProcessReader(r *Reader) (interface{}, error) {
+    var value interface{}
+    for {
+        form, err := r.Read()
+        if err == io.EOF {
+            return value, nil
+        } else if err != nil {
+            return nil, err
+        }
+        if value, err = in.ProcessTokens(r.positioned(form)); err != nil {
+            return nil, err
+        }
+    }
+}
@@ -0,0 +1,365 @@
+package glisp
+
+import ( "fmt" )
+
+// tailCall is what special forms and closures return instead of evaluating
+// their last form themselves. GetValue picks it up and keeps looping, so a
+// call in tail position doesn't grow the Go stack.
+type tailCall struct {
+    scope *Scope
+    form interface{}
+}
+
+// Closure is what a lambda evaluates to. It remembers the scope it was
+// created in, and its parameters are bound in a child of that scope. def
+// gives an anonymous Closure the name it is defined as. If the body starts
+// with a string and has more forms after it, the string is its docstring.
+//
+// A parameter list has required names, then optionally &optional names,
+// a rest name (after &rest, or after a dot as in (a . rest)) and &key
+// names. An &optional or &key name can be written (name default); default
+// is evaluated, after the parameters before it are bound, when the caller
+// leaves that argument out. A lone symbol instead of a list, as in
+// (lambda args ...), collects every argument.
+type Closure struct {
+    name string
+    doc string
+    params interface{}
+    required []string
+    optional []optionalParam
+    rest string
+    keys []optionalParam
+    body List
+    scope *Scope
+}
+
+type optionalParam struct {
+    name string
+    init interface{}
+}
+
+func (c *Closure) String() string {
+    if c.name != "" {
+        return fmt.Sprintf("#<lambda %v %v>", c.name, Write(c.params))
+    }
+    return fmt.Sprintf("#<lambda %v>", Write(c.params))
+}
+
+// Name is the name c was first defined as, or "" if it has never been.
+func (c *Closure) Name() string {
+    return c.name
+}
+
+// Doc is c's docstring, or "" if it has none.
+func (c *Closure) Doc() string {
+    return c.doc
+}
+
+// Params is the parameter list as it was written.
+func (c *Closure) Params() interface{} {
+    return c.params
+}
+
+// Body is the forms c evaluates, not counting its docstring.
+func (c *Closure) Body() List {
+    return c.body
+}
+
+// Scope is the scope c was created in.
+func (c *Closure) Scope() *Scope {
+    return c.scope
+}
+
+// Arity reports how many arguments c takes. max is -1 if there is no
+// upper limit.
+func (c *Closure) Arity() (min, max int) {
+    if c.rest != "" || len(c.keys) > 0 {
+        return len(c.required), -1
+    }
+    return len(c.required), len(c.required) + len(c.optional)
+}
+
+// paramSections are the lambda list keywords, in the order they must come.
+var paramSections = map[string]int {
+    "&optional": 1,
+    "&rest"    : 2,
+    "."        : 2,
+    "&key"     : 3,
+}
+
+func newClosure(scope *Scope, params interface{}, body List) (*Closure, error) {
+    c := &Closure{params: params, body: body, scope: scope}
+    if doc, ok := body.First().(string); ok && len(body) > 1 {
+        c.doc, c.body = doc, body.Rest()
+    }
+    if sym, ok := params.(Symbol); ok {
+        c.rest = sym.key()
+        return c, nil
+    }
+    decls, ok := params.(List)
+    if dotted, isPair := params.(*Pair); isPair {
+        decls, ok = dottedParams(dotted), true
+    }
+    if !ok {
+        return nil, NewError(TYPE_ERROR, params, "LAMBDA expects a list of parameter names; found %v", Write(params))
+    }
+    section := ""
+    for i, decl := range decls {
+        if sym, ok := decl.(Symbol); ok {
+            if rank, ok := paramSections[sym.Str()]; ok {
+                if rank <= paramSections[section] || (section == "&rest" && c.rest == "") {
+                    return nil, NewError(EVAL_ERROR, decl, "LAMBDA parameters have %v out of place - %v", sym.Str(), Write(decls))
+                } else if sym.Str() == "." && i != len(decls) - 2 {
+                    return nil, NewError(EVAL_ERROR, decl, "LAMBDA expects exactly one name after . - %v", Write(decls))
+                }
+                section = sym.Str()
+                continue
+            }
+        }
+        name, init, err := paramDecl(section, decl)
+        if err != nil {
+            return nil, err
+        }
+        switch section {
+        case "":
+            c.required = append(c.required, name)
+        case "&optional":
+            c.optional = append(c.optional, optionalParam{name, init})
+        case "&rest", ".":
+            if c.rest != "" {
+                return nil, NewError(EVAL_ERROR, decl, "LAMBDA expects exactly one name after %v - %v", section, Write(decls))
+            }
+            c.rest = name
+        case "&key":
+            c.keys = append(c.keys, optionalParam{name, init})
+        }
+    }
+    if (section == "&rest" || section == ".") && c.rest == "" {
+        return nil, NewError(EVAL_ERROR, decls, "LAMBDA expects a name after %v - %v", section, Write(decls))
+    }
+    return c, nil
+}
+
+// dottedParams turns (a b . rest), which reads as Pairs, into the List
+// (a b . rest) with the dot as a symbol, the same as &rest.
+func dottedParams(p *Pair) List {
+    decls := List{}
+    tail, ok := walkPairs(p, func(car Value) {
+        decls = append(decls, car)
+    })
+    if !ok {
+        return append(decls, symbol("."), p)
+    }
+    if list, ok := tail.(List); ok {
+        return append(decls, list...)
+    }
+    return append(decls, symbol("."), tail)
+}
+
+// paramDecl reads one parameter: a name or, for &optional and &key ones,
+// (name default).
+func paramDecl(section string, decl interface{}) (string, interface{}, error) {
+    if list, ok := decl.(List); ok && (section == "&optional" || section == "&key") && len(list) == 2 {
+        decl = list[0]
+        if sym, ok := decl.(Symbol); ok {
+            return sym.key(), list[1], nil
+        }
+    }
+    sym, ok := decl.(Symbol)
+    if !ok {
+        return "", nil, NewError(TYPE_ERROR, decl, "LAMBDA parameters must be symbols; found %v", Write(decl))
+    }
+    return sym.key(), nil, nil
+}
+
+// arity describes how many arguments c takes, for error messages.
+func (c *Closure) arity() string {
+    min, max := c.Arity()
+    switch {
+    case max < 0:
+        return fmt.Sprintf("at least %v", arguments(min))
+    case min == max:
+        return arguments(min)
+    }
+    return fmt.Sprintf("%v to %v", min, arguments(max))
+}
+
+func arguments(n int) string {
+    if n == 1 {
+        return "1 argument"
+    }
+    return fmt.Sprintf("%v arguments", n)
+}
+
+// call binds args and evaluates the body, leaving the last form as a
+// tailCall for the caller to finish.
+func (c *Closure) call(args List) (interface{}, error) {
+    if min, max := c.Arity(); len(args) < min || (max >= 0 && len(args) > max) {
+        return nil, errorAtCall(ARITY_ERROR, args, "%v expects %v; got %v", c, c.arity(), len(args))
+    }
+    inner := c.scope.child()
+    for i, name := range c.required {
+        inner.add(name, args[i])
+    }
+    extra := args[len(c.required):]
+    for _, p := range c.optional {
+        if len(extra) > 0 {
+            inner.add(p.name, extra[0])
+            extra = extra[1:]
+            continue
+        }
+        value, err := GetValue(inner, p.init)
+        if err != nil {
+            return nil, err
+        }
+        inner.add(p.name, value)
+    }
+    if c.rest != "" {
+        inner.add(c.rest, append(List{}, extra...))
+    }
+    if len(c.keys) > 0 {
+        if err := c.bindKeys(inner, extra); err != nil {
+            return nil, err
+        }
+    }
+    return evalBody(inner, c.body)
+}
+
+// bindKeys binds &key parameters from args, which alternate between
+// keywords like :name and their values.
+func (c *Closure) bindKeys(inner *Scope, args List) error {
+    if len(args) % 2 != 0 {
+        return errorAtCall(ARITY_ERROR, args, "%v expects keyword arguments in pairs; got %v", c, Write(args))
+    }
+    given := map[string]interface{}{}
+    for i := 0; i < len(args); i += 2 {
+        key, ok := args[i].(Symbol)
+        if !ok || !key.isKeyword() {
+            return NewError(EVAL_ERROR, args, "%v expects a keyword like :name; found %v", c, Write(args[i]))
+        }
+        given[key.Str()[1:]] = args[i+1]
+    }
+    for _, p := range c.keys {
+        value, ok := given[p.name]
+        if !ok {
+            var err error
+            if value, err = GetValue(inner, p.init); err != nil {
+                return err
+            }
+        }
+        delete(given, p.name)
+        inner.add(p.name, value)
+    }
+    for name := range given {
+        return NewError(EVAL_ERROR, args, "%v has no keyword parameter :%v", c, name)
+    }
+    return nil
+}
+
+func lambda(scope *Scope, params List) (interface{}, error) {
+    if len(params) < 1 {
+        return nil, errorAtCall(ARITY_ERROR, params, "LAMBDA requires a parameter list and a body")
+    }
+    return newClosure(scope, params.First(), params.Rest())
+}
+
+// procedureArity returns (min max), where max is nil if there is no upper
+// limit. Builtins check their own arguments, so their arity isn't known,
+// and is #f.
+func procedureArity(_ *Scope, params List) (interface{}, error) {
+    if err := exactly("procedure-arity", params, 1); err != nil {
+        return nil, err
+    }
+    switch f := params[0].(type) {
+    case *Closure:
+        min, max := f.Arity()
+        if max < 0 {
+            return List{int64(min), nil}, nil
+        }
+        return List{int64(min), int64(max)}, nil
+    case *builtin, Function, NonEvaluatingFunction:
+        return false, nil
+    }
+    return nil, notAProcedure("procedure-arity", params[0])
+}
+
+// procedureName returns the name a closure or macro was defined as, or a
+// builtin is bound to, as a symbol, or nil for anonymous closures.
+func procedureName(_ *Scope, params List) (interface{}, error) {
+    if err := exactly("procedure-name", params, 1); err != nil {
+        return nil, err
+    }
+    switch f := params[0].(type) {
+    case *Closure:
+        if f.name != "" {
+            return symbol(f.name), nil
+        }
+        return nil, nil
+    case *macro:
+        return symbol(f.name), nil
+    case *builtin:
+        return symbol(f.name), nil
+    case Function, NonEvaluatingFunction:
+        return nil, nil
+    }
+    return nil, notAProcedure("procedure-name", params[0])
+}
+
+// doc returns the docstring of a closure, or of the transformer of a macro,
+// or nil if it has none.
+func doc(_ *Scope, params List) (interface{}, error) {
+    if err := exactly("doc", params, 1); err != nil {
+        return nil, err
+    }
+    fn := params[0]
+    if m, ok := fn.(*macro); ok {
+        fn = m.transformer
+    }
+    switch f := fn.(type) {
+    case *Closure:
+        if f.doc != "" {
+            return f.doc, nil
+        }
+        return nil, nil
+    case *builtin, Function, NonEvaluatingFunction:
+        return nil, nil
+    }
+    return nil, notAProcedure("doc", params[0])
+}
+
+func notAProcedure(name string, value interface{}) error {
+    return NewError(TYPE_ERROR, value, "%v expects a procedure; found %v", name, Write(value))
+}
+
+func begin(scope *Scope, params List) (interface{}, error) {
+    return evalBody(scope, params)
+}
+
+// invoke takes one step of calling fn on already-evaluated args. The result
+// may be a tailCall; callFunction is the version that finishes the job.
+func invoke(scope *Scope, fn interface{}, args List) (interface{}, error) {
+    switch f := fn.(type) {
+    case *builtin:
+        return invoke(scope, f.fn, args)
+    case Function:
+        return f(scope, args)
+    case NonEvaluatingFunction:
+        return f(scope, args)
+    case *Closure:
+        return f.call(args)
+    }
+    return nil, NewError(CALL_ERROR, fn, "Cannot call %v; it is not a function", Write(fn))
+}
+
+// callFunction calls fn from Go code, such as a builtin that takes a
+// function as a parameter, and returns its final value.
+func callFunction(scope *Scope, fn interface{}, args List) (interface{}, error) {
+    value, err := invoke(scope, fn, args)
+    if err != nil {
+        return nil, err
+    }
+    if tail, ok := value.(*tailCall); ok {
+        return GetValue(tail.scope, tail.form)
+    }
+    return value, nil
+}
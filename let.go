@@ -0,0 +1,163 @@
+package glisp
+
+type binding struct {
+    name Symbol
+    init interface{}
+}
+
+// parseBindings accepts both ((a 1) (b 2)) and the flatter (a 1 b 2).
+func parseBindings(form string, decls interface{}) ([]binding, error) {
+    list, ok := decls.(List)
+    if !ok {
+        return nil, NewError(TYPE_ERROR, decls, "%v expects a list of bindings; found %v", form, Write(decls))
+    }
+    bindings := []binding{}
+    if _, flat := list.First().(Symbol); flat {
+        if len(list) % 2 != 0 {
+            return nil, NewError(ARITY_ERROR, list, "%v bindings must come in name/value pairs - %v", form, Write(list))
+        }
+        for i := 0; i < len(list); i += 2 {
+            b, err := makeBinding(form, list[i], list[i+1])
+            if err != nil {
+                return nil, err
+            }
+            bindings = append(bindings, b)
+        }
+        return bindings, nil
+    }
+    for _, decl := range list {
+        pair, ok := decl.(List)
+        if !ok || len(pair) != 2 {
+            return nil, NewError(TYPE_ERROR, decl, "%v expects each binding to be a (name value) pair; found %v", form, Write(decl))
+        }
+        b, err := makeBinding(form, pair[0], pair[1])
+        if err != nil {
+            return nil, err
+        }
+        bindings = append(bindings, b)
+    }
+    return bindings, nil
+}
+
+func makeBinding(form string, name interface{}, init interface{}) (binding, error) {
+    sym, ok := name.(Symbol)
+    if !ok {
+        return binding{}, NewError(TYPE_ERROR, name, "%v can only bind symbols; found %v", form, Write(name))
+    }
+    return binding{sym, init}, nil
+}
+
+// evalBody evaluates all but the last form, and returns the last as a
+// tailCall.
+func evalBody(scope *Scope, body List) (interface{}, error) {
+    if len(body) == 0 {
+        return nil, nil
+    }
+    for _, form := range body[:len(body)-1] {
+        if _, err := GetValue(scope, form); err != nil {
+            return nil, err
+        }
+    }
+    return &tailCall{scope, body[len(body)-1]}, nil
+}
+
+// let evaluates every init in the enclosing scope before binding any of
+// them. (let name ((var init) ...) body...) is a named let: name is bound,
+// inside the body, to a function of the vars, which makes loops easy.
+func let(scope *Scope, params List) (interface{}, error) {
+    if name, named := params.First().(Symbol); named {
+        return namedLet(scope, name, params.Rest())
+    }
+    if len(params) < 1 {
+        return nil, errorAtCall(ARITY_ERROR, params, "LET requires bindings and a body")
+    }
+    bindings, err := parseBindings("LET", params.First())
+    if err != nil {
+        return nil, err
+    }
+    inner := scope.child()
+    for _, b := range bindings {
+        value, err := GetValue(scope, b.init)
+        if err != nil {
+            return nil, err
+        }
+        inner.add(b.name.key(), value)
+    }
+    return evalBody(inner, params.Rest())
+}
+
+func namedLet(scope *Scope, name Symbol, params List) (interface{}, error) {
+    bindings, err := parseBindings("LET", params.First())
+    if err != nil {
+        return nil, err
+    }
+    names := List{}
+    args := List{}
+    for _, b := range bindings {
+        value, err := GetValue(scope, b.init)
+        if err != nil {
+            return nil, err
+        }
+        names = append(names, b.name)
+        args = append(args, value)
+    }
+    loopScope := scope.child()
+    loop, err := newClosure(loopScope, names, params.Rest())
+    if err != nil {
+        return nil, err
+    }
+    loop.name = name.Str()
+    loopScope.add(name.key(), loop)
+    return loop.call(args)
+}
+
+// letStar binds one at a time, so each init can see the ones before it.
+func letStar(scope *Scope, params List) (interface{}, error) {
+    if len(params) < 1 {
+        return nil, errorAtCall(ARITY_ERROR, params, "LET* requires bindings and a body")
+    }
+    bindings, err := parseBindings("LET*", params.First())
+    if err != nil {
+        return nil, err
+    }
+    inner := scope
+    for _, b := range bindings {
+        value, err := GetValue(inner, b.init)
+        if err != nil {
+            return nil, err
+        }
+        inner = inner.child()
+        inner.add(b.name.key(), value)
+    }
+    return evalBody(inner.child(), params.Rest())
+}
+
+// unassigned is what letrec binds its names to until their inits have run,
+// so that reading one too early is an error rather than a quiet nil.
+type unassignedValue struct{}
+
+var unassigned = unassignedValue{}
+
+// letrec binds every name before evaluating any init, so functions bound by
+// it can call each other.
+func letrec(scope *Scope, params List) (interface{}, error) {
+    if len(params) < 1 {
+        return nil, errorAtCall(ARITY_ERROR, params, "LETREC requires bindings and a body")
+    }
+    bindings, err := parseBindings("LETREC", params.First())
+    if err != nil {
+        return nil, err
+    }
+    inner := scope.child()
+    for _, b := range bindings {
+        inner.add(b.name.key(), unassigned)
+    }
+    for _, b := range bindings {
+        value, err := GetValue(inner, b.init)
+        if err != nil {
+            return nil, err
+        }
+        inner.add(b.name.key(), value)
+    }
+    return evalBody(inner, params.Rest())
+}
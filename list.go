@@ -1,7 +1,5 @@
 package glisp
 
-import ( "fmt" )
-
 type List []interface{}
 
 func (all List) First() interface{} {
@@ -22,50 +20,63 @@ func (all List) Rest() List {
     return nil
 }
 
-func (node List) IsLambda() bool {
-    if len(node) > 1 {
-        token, isToken := node[0].(Token)
-        return isToken && token.Str() == "lambda"
+func (value List) Eval(scope *Scope) (interface{}, error) {
+    return GetValue(scope, value)
+}
+
+// step evaluates the head of the list and calls it. Special forms and
+// closures may hand back a tailCall for GetValue to carry on with.
+func (value List) step(scope *Scope) (interface{}, error) {
+    result, err := value.call(scope)
+    if err != nil {
+        return nil, locate(err, value)
     }
-    return false
+    return result, nil
 }
 
-func (value List) Eval(scope *Scope) interface{} {
-    if scope.isMacroScope {
-        return value
+func (value List) call(scope *Scope) (interface{}, error) {
+    if len(value) == 0 {
+        return value, nil
     }
-    switch firstValue := value[0].(type) {
-    case NonEvaluatingFunction:
-        return firstValue(scope, value.Rest())
-    case Function:
-        params := value.Rest().GetValues(scope)
-        return firstValue(scope, params)
-    case List:
-        lastElement := interface{}(nil)
-        for _, element := range value {
-            lastElement = GetValue(scope, element)
+    fn, err := GetValue(scope, value[0])
+    if err != nil {
+        return nil, err
+    }
+    if b, ok := fn.(*builtin); ok {
+        fn = b.fn
+    }
+    switch f := fn.(type) {
+    case *macro:
+        // Macros are normally expanded before evaluation; this catches
+        // one that wasn't defined yet when its caller was expanded.
+        expanded, err := f.expand(scope, value.Rest())
+        if err != nil {
+            return nil, err
+        }
+        if expanded, err = expand(scope, nil, expanded); err != nil {
+            return nil, err
         }
-        return lastElement
-    case Valuable:
-        switch symb := firstValue.Eval(scope).(type) {
-        case NonEvaluatingFunction:
-            x := symb(scope, value.Rest())
-            return x
-        case Function:
-            params := value.Rest().GetValues(scope)
-            x := symb(scope, params)
-            return x
-        default:
-            panic(fmt.Sprintf("A list should be either a function or a nested list (probably actually a high-order function) - found %T %v in %v\n", firstValue, firstValue, value))
+        return &tailCall{scope, expanded}, nil
+    case NonEvaluatingFunction:
+        return invoke(scope, fn, value.Rest())
+    case Function, *Closure:
+        params, err := value.Rest().GetValues(scope)
+        if err != nil {
+            return nil, err
         }
+        return invoke(scope, fn, params)
     }
-    panic(fmt.Sprintf("Could not evaluate list: %v\n", value))
+    return nil, NewError(CALL_ERROR, value, "A list should start with a function - found %v in %v", Write(fn), Write(value))
 }
 
-func (things List) GetValues(scope *Scope) List {
+func (things List) GetValues(scope *Scope) (List, error) {
     output := List{}
-    for _, i := range things {
-        output = append(output, GetValue(scope, i))
+    for i, thing := range things {
+        value, err := GetValue(scope, thing)
+        if err != nil {
+            return nil, locateAt(err, PositionIn(things, i))
+        }
+        output = append(output, value)
     }
-    return output
+    return output, nil
 }
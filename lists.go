@@ -0,0 +1,396 @@
+package glisp
+
+import (
+    "sort"
+)
+
+// elements returns the elements of a proper list, which is a List or a
+// chain of Pairs ending in one. A chain that loops back on itself isn't.
+func elements(name string, value Value) (List, error) {
+    if list, ok := value.(List); ok {
+        return list, nil
+    }
+    r := List{}
+    tail, ok := walkPairs(value, func(car Value) {
+        r = append(r, car)
+    })
+    if !ok {
+        return nil, NewError(TYPE_ERROR, value, "%v expects a list; found the circular list %v", name, Write(value))
+    }
+    if rest, ok := tail.(List); ok {
+        return append(r, rest...), nil
+    }
+    return nil, NewError(TYPE_ERROR, value, "%v expects a list; found %v", name, Write(value))
+}
+
+// lists is elements for every param from the ith on.
+func lists(name string, params List, i int) ([]List, error) {
+    r := []List{}
+    for _, p := range params[i:] {
+        list, err := elements(name, p)
+        if err != nil {
+            return nil, err
+        }
+        r = append(r, list)
+    }
+    return r, nil
+}
+
+// columns lines lists up side by side: the nth column holds the nth
+// element of each list. It stops at the end of the shortest one.
+func columns(ls []List) []List {
+    n := -1
+    for _, l := range ls {
+        if n < 0 || len(l) < n {
+            n = len(l)
+        }
+    }
+    r := []List{}
+    for i := 0; i < n; i++ {
+        column := List{}
+        for _, l := range ls {
+            column = append(column, l[i])
+        }
+        r = append(r, column)
+    }
+    return r
+}
+
+// index reads a non-negative integer argument.
+func index(name string, value Value) (int, error) {
+    n, ok := value.(int64)
+    if !ok || n < 0 {
+        return 0, NewError(TYPE_ERROR, value, "%v expects a non-negative integer index; found %v", name, Write(value))
+    }
+    return int(n), nil
+}
+
+func list(_ *Scope, params List) (interface{}, error) {
+    return append(List{}, params...), nil
+}
+
+func length(_ *Scope, params List) (interface{}, error) {
+    if err := exactly("length", params, 1); err != nil {
+        return nil, err
+    }
+    list, err := elements("length", params[0])
+    if err != nil {
+        return nil, err
+    }
+    return int64(len(list)), nil
+}
+
+// appendLists copies every list but the last, which becomes the tail of the
+// result as it is. If the last isn't a list the result is improper:
+// (append '(1) 2) is (1 . 2).
+func appendLists(_ *Scope, params List) (interface{}, error) {
+    if len(params) == 0 {
+        return List{}, nil
+    }
+    heads, err := lists("append", params[:len(params)-1], 0)
+    if err != nil {
+        return nil, err
+    }
+    r := List{}
+    for _, head := range heads {
+        r = append(r, head...)
+    }
+    last := params[len(params)-1]
+    if tail, err := elements("append", last); err == nil {
+        return append(r, tail...), nil
+    }
+    for i := len(r) - 1; i >= 0; i-- {
+        last = consOnto(r[i], last)
+    }
+    return last, nil
+}
+
+func reverse(_ *Scope, params List) (interface{}, error) {
+    if err := exactly("reverse", params, 1); err != nil {
+        return nil, err
+    }
+    list, err := elements("reverse", params[0])
+    if err != nil {
+        return nil, err
+    }
+    r := make(List, len(list))
+    for i, element := range list {
+        r[len(list)-1-i] = element
+    }
+    return r, nil
+}
+
+// tailAt follows k cdrs down from value, so it works on improper lists too.
+func tailAt(name string, value Value, k int) (Value, error) {
+    for i := 0; i < k; i++ {
+        _, tail, ok := split(value)
+        if !ok {
+            return nil, NewError(EVAL_ERROR, value, "%v: index %v is past the end of the list", name, k)
+        }
+        value = tail
+    }
+    return value, nil
+}
+
+func listTail(_ *Scope, params List) (interface{}, error) {
+    if err := exactly("list-tail", params, 2); err != nil {
+        return nil, err
+    }
+    k, err := index("list-tail", params[1])
+    if err != nil {
+        return nil, err
+    }
+    return tailAt("list-tail", params[0], k)
+}
+
+func listRef(_ *Scope, params List) (interface{}, error) {
+    if err := exactly("list-ref", params, 2); err != nil {
+        return nil, err
+    }
+    k, err := index("list-ref", params[1])
+    if err != nil {
+        return nil, err
+    }
+    tail, err := tailAt("list-ref", params[0], k)
+    if err != nil {
+        return nil, err
+    }
+    head, _, ok := split(tail)
+    if !ok {
+        return nil, NewError(EVAL_ERROR, params, "list-ref: index %v is past the end of the list", k)
+    }
+    return head, nil
+}
+
+// matcher returns the test member and assoc use: equal?, unless the caller
+// passed its own as the optional last param.
+func matcher(scope *Scope, name string, params List) (func(a, b Value) (bool, error), error) {
+    if err := atLeast(name, params, 2); err != nil {
+        return nil, err
+    } else if len(params) > 3 {
+        return nil, errorAtCall(ARITY_ERROR, params, "%v takes at most 3 parameters; you have %v", name, len(params))
+    }
+    if len(params) == 2 {
+        return func(a, b Value) (bool, error) { return Equal(a, b), nil }, nil
+    }
+    return func(a, b Value) (bool, error) {
+        same, err := callFunction(scope, params[2], List{a, b})
+        return truthy(same), err
+    }, nil
+}
+
+// member returns the tail of the list starting at the first element that
+// matches, or #f. Like the other list functions it wants a proper list,
+// but it only finds out an improper or circular one is one if it gets to
+// the end, or back where it has been. That is checked as walkPairs does.
+func member(scope *Scope, params List) (interface{}, error) {
+    same, err := matcher(scope, "member", params)
+    if err != nil {
+        return nil, err
+    }
+    tail, slow := params[1], params[1]
+    for i := 0; ; i++ {
+        head, rest, ok := split(tail)
+        if _, empty := tail.(List); !ok && empty {
+            return false, nil
+        } else if !ok {
+            return nil, NewError(TYPE_ERROR, params[1], "member expects a list; found %v", Write(params[1]))
+        }
+        if found, err := same(params[0], head); err != nil || found {
+            return tail, err
+        }
+        tail = rest
+        if i % 2 == 1 {
+            _, slow, _ = split(slow)
+        }
+        if p, ok := tail.(*Pair); ok && p == slow {
+            return nil, NewError(TYPE_ERROR, params[1], "member expects a list; found the circular list %v", Write(params[1]))
+        }
+    }
+}
+
+// assoc returns the first entry of an association list whose car matches,
+// or #f. Entries can be pairs, like (a . 1), or lists, like (a 1).
+func assoc(scope *Scope, params List) (interface{}, error) {
+    same, err := matcher(scope, "assoc", params)
+    if err != nil {
+        return nil, err
+    }
+    entries, err := elements("assoc", params[1])
+    if err != nil {
+        return nil, err
+    }
+    for _, entry := range entries {
+        key, _, ok := split(entry)
+        if !ok {
+            return nil, NewError(TYPE_ERROR, entry, "assoc expects a list of pairs; found %v", Write(entry))
+        }
+        if found, err := same(params[0], key); err != nil || found {
+            return entry, err
+        }
+    }
+    return false, nil
+}
+
+// mapLists calls the function in the first param on the first element of
+// every list, then the second, and so on until the shortest list runs out.
+func mapLists(scope *Scope, params List) (interface{}, error) {
+    if err := atLeast("map", params, 2); err != nil {
+        return nil, err
+    }
+    ls, err := lists("map", params, 1)
+    if err != nil {
+        return nil, err
+    }
+    r := List{}
+    for _, args := range columns(ls) {
+        value, err := callFunction(scope, params[0], args)
+        if err != nil {
+            return nil, err
+        }
+        r = append(r, value)
+    }
+    return r, nil
+}
+
+func forEach(scope *Scope, params List) (interface{}, error) {
+    if err := atLeast("for-each", params, 2); err != nil {
+        return nil, err
+    }
+    ls, err := lists("for-each", params, 1)
+    if err != nil {
+        return nil, err
+    }
+    for _, args := range columns(ls) {
+        if _, err := callFunction(scope, params[0], args); err != nil {
+            return nil, err
+        }
+    }
+    return nil, nil
+}
+
+func filter(scope *Scope, params List) (interface{}, error) {
+    if err := exactly("filter", params, 2); err != nil {
+        return nil, err
+    }
+    list, err := elements("filter", params[1])
+    if err != nil {
+        return nil, err
+    }
+    r := List{}
+    for _, element := range list {
+        keep, err := callFunction(scope, params[0], List{element})
+        if err != nil {
+            return nil, err
+        }
+        if truthy(keep) {
+            r = append(r, element)
+        }
+    }
+    return r, nil
+}
+
+// reduce is fold-left without an initial value: (reduce f default list)
+// calls (f element acc), starting with the first element as acc. An empty
+// list gives default.
+func reduce(scope *Scope, params List) (interface{}, error) {
+    if err := exactly("reduce", params, 3); err != nil {
+        return nil, err
+    }
+    list, err := elements("reduce", params[2])
+    if err != nil {
+        return nil, err
+    }
+    if len(list) == 0 {
+        return params[1], nil
+    }
+    acc := list[0]
+    for _, element := range list[1:] {
+        if acc, err = callFunction(scope, params[0], List{element, acc}); err != nil {
+            return nil, err
+        }
+    }
+    return acc, nil
+}
+
+// foldLeft calls (f acc e1 e2 ...) from the first elements to the last.
+func foldLeft(scope *Scope, params List) (interface{}, error) {
+    if err := atLeast("fold-left", params, 3); err != nil {
+        return nil, err
+    }
+    ls, err := lists("fold-left", params, 2)
+    if err != nil {
+        return nil, err
+    }
+    acc := params[1]
+    for _, column := range columns(ls) {
+        if acc, err = callFunction(scope, params[0], append(List{acc}, column...)); err != nil {
+            return nil, err
+        }
+    }
+    return acc, nil
+}
+
+// foldRight calls (f e1 e2 ... acc) from the last elements to the first.
+func foldRight(scope *Scope, params List) (interface{}, error) {
+    if err := atLeast("fold-right", params, 3); err != nil {
+        return nil, err
+    }
+    ls, err := lists("fold-right", params, 2)
+    if err != nil {
+        return nil, err
+    }
+    acc := params[1]
+    cs := columns(ls)
+    for i := len(cs) - 1; i >= 0; i-- {
+        if acc, err = callFunction(scope, params[0], append(cs[i], acc)); err != nil {
+            return nil, err
+        }
+    }
+    return acc, nil
+}
+
+// sortList returns a sorted copy of a list. The sort is stable, and less
+// is called as (less a b).
+func sortList(scope *Scope, params List) (interface{}, error) {
+    if err := exactly("sort", params, 2); err != nil {
+        return nil, err
+    }
+    list, err := elements("sort", params[0])
+    if err != nil {
+        return nil, err
+    }
+    r := append(List{}, list...)
+    sort.SliceStable(r, func(i, j int) bool {
+        if err != nil {
+            return false
+        }
+        var less interface{}
+        less, err = callFunction(scope, params[1], List{r[i], r[j]})
+        return err == nil && truthy(less)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+func listBuiltins() map[string]interface{} {
+    return map[string]interface{} {
+        "list"      : Function(list),
+        "length"    : Function(length),
+        "append"    : Function(appendLists),
+        "reverse"   : Function(reverse),
+        "list-tail" : Function(listTail),
+        "list-ref"  : Function(listRef),
+        "member"    : Function(member),
+        "assoc"     : Function(assoc),
+        "map"       : Function(mapLists),
+        "for-each"  : Function(forEach),
+        "filter"    : Function(filter),
+        "reduce"    : Function(reduce),
+        "fold-left" : Function(foldLeft),
+        "fold-right": Function(foldRight),
+        "sort"      : Function(sortList),
+    }
+}
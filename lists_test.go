@@ -0,0 +1,115 @@
+package glisp
+
+import (
+    "testing"
+
+    . "github.com/tychofreeman/go-matchers"
+)
+
+func TestList(t *testing.T) {
+    AssertThat(t, process(t, "(list 1 (+ 1 1) \"three\")"), HasExactly(int64(1), int64(2), "three"))
+    AssertThat(t, process(t, "(list)"), IsEmpty)
+}
+
+func TestLength(t *testing.T) {
+    AssertThat(t, process(t, "(length '(a b c))"), Equals(int64(3)))
+    AssertThat(t, process(t, "(length '())"), Equals(int64(0)))
+    AssertThat(t, process(t, "(length (cons 1 (cons 2 '())))"), Equals(int64(2)))
+    AssertThat(t, processError(t, "(length '(1 . 2))").Kind, Equals(TYPE_ERROR))
+}
+
+func TestAppend(t *testing.T) {
+    AssertThat(t, process(t, "(append '(1 2) '() '(3) '(4 5))"), HasExactly(int64(1), int64(2), int64(3), int64(4), int64(5)))
+    AssertThat(t, process(t, "(append)"), IsEmpty)
+    AssertThat(t, Write(process(t, "(append '(1) '(2) 3)")), Equals("(1 2 . 3)"))
+    AssertThat(t, processError(t, "(append 1 '(2))").Kind, Equals(TYPE_ERROR))
+}
+
+func TestAppendDoesNotChangeItsArguments(t *testing.T) {
+    AssertThat(t, process(t, "(def xs '(1 2)) (append xs '(3)) xs"), HasExactly(int64(1), int64(2)))
+}
+
+func TestReverse(t *testing.T) {
+    AssertThat(t, process(t, "(reverse '(1 2 3))"), HasExactly(int64(3), int64(2), int64(1)))
+    AssertThat(t, process(t, "(reverse '())"), IsEmpty)
+}
+
+func TestListRefAndListTail(t *testing.T) {
+    AssertThat(t, process(t, "(list-ref '(a b c) 1)"), Equals(symbol("b")))
+    AssertThat(t, process(t, "(list-tail '(a b c) 2)"), HasExactly(symbol("c")))
+    AssertThat(t, process(t, "(list-tail '(1 2 . 3) 2)"), Equals(int64(3)))
+    AssertThat(t, processError(t, "(list-ref '(a b c) 3)").Kind, Equals(EVAL_ERROR))
+    AssertThat(t, processError(t, "(list-ref '(a b c) -1)").Kind, Equals(TYPE_ERROR))
+}
+
+func TestMember(t *testing.T) {
+    AssertThat(t, process(t, "(member 2 '(1 2 3))"), HasExactly(int64(2), int64(3)))
+    AssertThat(t, process(t, "(member '(b) '(a (b) c))"), HasExactly(HasExactly(symbol("b")), symbol("c")))
+    AssertThat(t, process(t, "(member 4 '(1 2 3))"), IsFalse)
+    AssertThat(t, process(t, "(member 2.0 '(1 2 3) =)"), HasExactly(int64(2), int64(3)))
+}
+
+func TestMemberNeedsAList(t *testing.T) {
+    AssertThat(t, processError(t, "(member 1 5)").Kind, Equals(TYPE_ERROR))
+    AssertThat(t, processError(t, "(member 4 '(1 2 . 3))").Kind, Equals(TYPE_ERROR))
+    AssertThat(t, process(t, "(member 4 (cons 1 (cons 2 '())))"), IsFalse)
+}
+
+func TestAssoc(t *testing.T) {
+    AssertThat(t, Write(process(t, "(assoc 'b '((a . 1) (b . 2)))")), Equals("(b . 2)"))
+    AssertThat(t, process(t, "(assoc \"b\" '((\"a\" 1) (\"b\" 2)))"), HasExactly("b", int64(2)))
+    AssertThat(t, process(t, "(assoc 'z '((a . 1)))"), IsFalse)
+    AssertThat(t, processError(t, "(assoc 'z '(a))").Kind, Equals(TYPE_ERROR))
+}
+
+func TestMapTakesClosuresAndBuiltins(t *testing.T) {
+    AssertThat(t, process(t, "(map (lambda (x) (* x x)) '(1 2 3))"), HasExactly(int64(1), int64(4), int64(9)))
+    AssertThat(t, process(t, "(map car '((a 1) (b 2)))"), HasExactly(symbol("a"), symbol("b")))
+}
+
+func TestMapOverSeveralListsStopsAtTheShortest(t *testing.T) {
+    AssertThat(t, process(t, "(map + '(1 2 3) '(10 20 30 40) '(100 200 300))"), HasExactly(int64(111), int64(222), int64(333)))
+    AssertThat(t, process(t, "(map list '(a b) '(1))"), HasExactly(HasExactly(symbol("a"), int64(1))))
+}
+
+func TestForEachRunsForSideEffects(t *testing.T) {
+    AssertThat(t, process(t, "(def total 0) (for-each (lambda (x y) (set! total (+ total (* x y)))) '(1 2) '(3 4)) total"), Equals(int64(11)))
+}
+
+func TestFilter(t *testing.T) {
+    AssertThat(t, process(t, "(filter (lambda (x) (> x 1)) '(0 1 2 3))"), HasExactly(int64(2), int64(3)))
+    AssertThat(t, process(t, "(filter atom '(a (b) c))"), HasExactly(symbol("a"), symbol("c")))
+}
+
+func TestReduce(t *testing.T) {
+    AssertThat(t, process(t, "(reduce + 0 '(1 2 3 4))"), Equals(int64(10)))
+    AssertThat(t, process(t, "(reduce + 0 '())"), Equals(int64(0)))
+    AssertThat(t, process(t, "(reduce - 0 '(1 2 3 4))"), Equals(int64(2)))
+}
+
+func TestFolds(t *testing.T) {
+    AssertThat(t, process(t, "(fold-left - 0 '(1 2 3))"), Equals(int64(-6)))
+    AssertThat(t, process(t, "(fold-right - 0 '(1 2 3))"), Equals(int64(2)))
+    AssertThat(t, process(t, "(fold-right cons '() '(1 2 3))"), HasExactly(int64(1), int64(2), int64(3)))
+    AssertThat(t, process(t, "(fold-left (lambda (acc x y) (+ acc (* x y))) 0 '(1 2) '(3 4))"), Equals(int64(11)))
+    AssertThat(t, Write(process(t, "(fold-right list 'end '(a b) '(1 2))")), Equals("(a 1 (b 2 end))"))
+}
+
+func TestSortWithAComparator(t *testing.T) {
+    AssertThat(t, process(t, "(sort '(3 1 2) <)"), HasExactly(int64(1), int64(2), int64(3)))
+    AssertThat(t, process(t, "(sort '(3 1 2) (lambda (a b) (> a b)))"), HasExactly(int64(3), int64(2), int64(1)))
+    AssertThat(t, process(t, "(map car (sort '((b 1) (a 1) (c 0)) (lambda (x y) (< (car (cdr x)) (car (cdr y))))))"), HasExactly(symbol("c"), symbol("b"), symbol("a")))
+}
+
+func TestSortDoesNotChangeItsArgument(t *testing.T) {
+    AssertThat(t, process(t, "(def xs '(3 1 2)) (sort xs <) xs"), HasExactly(int64(3), int64(1), int64(2)))
+}
+
+func TestSortReportsComparatorErrors(t *testing.T) {
+    AssertThat(t, processError(t, "(sort '(1 a) <)").Kind, Equals(TYPE_ERROR))
+}
+
+func TestHigherOrderFunctionsNeedProcedures(t *testing.T) {
+    AssertThat(t, processError(t, "(map 5 '(1 2))").Kind, Equals(CALL_ERROR))
+    AssertThat(t, processError(t, "(filter (lambda (x y) x) '(1 2))").Kind, Equals(ARITY_ERROR))
+}
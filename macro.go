@@ -0,0 +1,406 @@
+package glisp
+
+import (
+    "fmt"
+    "sync/atomic"
+)
+
+// macro is what defmacro binds. Its transformer gets the unevaluated forms
+// it was called with and returns a new form to evaluate in their place.
+type macro struct {
+    name string
+    transformer interface{}
+}
+
+func (m *macro) String() string {
+    return fmt.Sprintf("#<macro %v>", m.name)
+}
+
+func (m *macro) expand(scope *Scope, args List) (interface{}, error) {
+    return callFunction(scope, m.transformer, args)
+}
+
+func defmacro(scope *Scope, params List) (interface{}, error) {
+    name, err := defName("DEFMACRO", params)
+    if err != nil {
+        return nil, err
+    }
+    transformer, err := GetValue(scope, params.Rest().First())
+    if err != nil {
+        return nil, err
+    }
+    scope.add(name.key(), &macro{name.Str(), transformer})
+    return List{}, nil
+}
+
+// bound is the set of names, by key, that local bindings around a form
+// being expanded introduce. A call whose head is one of them calls that
+// local, not a macro with the same name.
+type bound map[string]bool
+
+// with returns a copy of b that also holds whichever of names are symbols.
+func (b bound) with(names ...interface{}) bound {
+    r := bound{}
+    for key := range b {
+        r[key] = true
+    }
+    for _, name := range names {
+        if sym, ok := name.(Symbol); ok {
+            r[sym.key()] = true
+        }
+    }
+    return r
+}
+
+// macroFor returns the macro a form calls, if it calls one.
+func macroFor(scope *Scope, shadowed bound, form interface{}) (*macro, List, bool) {
+    list, ok := form.(List)
+    if !ok || len(list) == 0 {
+        return nil, nil, false
+    }
+    sym, ok := list[0].(Symbol)
+    if !ok || shadowed[sym.key()] {
+        return nil, nil, false
+    }
+    value, _ := scope.lookup(sym)
+    m, ok := value.(*macro)
+    return m, list.Rest(), ok
+}
+
+func expand1(scope *Scope, shadowed bound, form interface{}) (interface{}, bool, error) {
+    m, args, ok := macroFor(scope, shadowed, form)
+    if !ok {
+        return form, false, nil
+    }
+    expanded, err := m.expand(scope, args)
+    if err != nil {
+        return nil, false, locate(err, form)
+    }
+    return expanded, true, nil
+}
+
+// expand rewrites every macro call in form, outermost first, until none are
+// left. Quoted data, parameter lists and binding names are left alone.
+// Macros are found by name in scope, unless a lambda or let around the call
+// binds that name locally: shadowed holds the names that are. Going into
+// a nested form counts towards the same limit as evaluation does.
+func expand(scope *Scope, shadowed bound, form interface{}) (interface{}, error) {
+    if err := scope.nest(form); err != nil {
+        return nil, err
+    }
+    defer scope.unnest()
+    for {
+        expanded, again, err := expand1(scope, shadowed, form)
+        if err != nil {
+            return nil, err
+        }
+        if !again {
+            break
+        }
+        form = expanded
+    }
+    list, ok := form.(List)
+    if !ok || len(list) == 0 {
+        return form, nil
+    }
+    head := ""
+    if sym, ok := list[0].(Symbol); ok && !shadowed[sym.key()] {
+        head = sym.Str()
+    }
+    switch head {
+    case "quote":
+        return list, nil
+    case "quasiquote":
+        return expandQuasiquote(scope, shadowed, list, 0)
+    case "lambda":
+        return expandTail(scope, shadowed.with(paramNames(list.Second())...), list, 2)
+    case "let", "let*", "letrec":
+        return expandLet(scope, shadowed, head, list)
+    }
+    return expandTail(scope, shadowed, list, 0)
+}
+
+// expandTail expands every element of list from index start on.
+func expandTail(scope *Scope, shadowed bound, list List, start int) (List, error) {
+    if len(list) < start {
+        return list, nil
+    }
+    output := append(List{}, list[:start]...)
+    for _, element := range list[start:] {
+        expanded, err := expand(scope, shadowed, element)
+        if err != nil {
+            return nil, err
+        }
+        output = append(output, expanded)
+    }
+    return keepPositions(output, list), nil
+}
+
+// paramNames returns the names a lambda parameter list binds.
+func paramNames(params interface{}) List {
+    var decls List
+    switch p := params.(type) {
+    case Symbol:
+        return List{p}
+    case *Pair:
+        decls = dottedParams(p)
+    case List:
+        decls = p
+    }
+    names := List{}
+    for _, decl := range decls {
+        if list, ok := decl.(List); ok && len(list) == 2 {
+            decl = list[0]
+        }
+        if sym, ok := decl.(Symbol); ok {
+            if _, keyword := paramSections[sym.Str()]; !keyword {
+                names = append(names, sym)
+            }
+        }
+    }
+    return names
+}
+
+// letNames returns the names bound by the bindings of a let, in order.
+func letNames(decls List, flat bool) List {
+    names := List{}
+    for i, decl := range decls {
+        if pair, ok := decl.(List); ok && !flat && len(pair) == 2 {
+            names = append(names, pair[0])
+        } else if flat && i % 2 == 0 {
+            names = append(names, decl)
+        }
+    }
+    return names
+}
+
+// expandLet expands a let, let* or letrec form. Its body sees every name it
+// binds; its inits see none of them for let, the ones before for let*, and
+// all of them for letrec.
+func expandLet(scope *Scope, shadowed bound, kind string, list List) (List, error) {
+    body := shadowed
+    bindingsAt := 1
+    if name, named := list.Second().(Symbol); named {
+        body = body.with(name)
+        bindingsAt = 2
+    }
+    if len(list) <= bindingsAt {
+        return list, nil
+    }
+    decls, ok := list[bindingsAt].(List)
+    if !ok {
+        return list, nil
+    }
+    _, flat := decls.First().(Symbol)
+    names := letNames(decls, flat)
+    body = body.with(names...)
+    inits := shadowed
+    if kind == "letrec" {
+        inits = inits.with(names...)
+    }
+    expandedDecls := List{}
+    for i, decl := range decls {
+        var expanded, name interface{}
+        var err error
+        if pair, ok := decl.(List); ok && !flat && len(pair) == 2 {
+            expanded, err = expandTail(scope, inits, pair, 1)
+            name = pair[0]
+        } else if flat && i % 2 == 1 {
+            expanded, err = expand(scope, inits, decl)
+            name = decls[i-1]
+        } else {
+            expanded = decl
+        }
+        if err != nil {
+            return nil, err
+        }
+        if kind == "let*" {
+            inits = inits.with(name)
+        }
+        expandedDecls = append(expandedDecls, expanded)
+    }
+    output := append(List{}, list[:bindingsAt]...)
+    output = append(output, keepPositions(expandedDecls, decls))
+    expandedBody, err := expandTail(scope, body, list[bindingsAt+1:], 0)
+    if err != nil {
+        return nil, err
+    }
+    return keepPositions(append(output, expandedBody...), list), nil
+}
+
+// expandQuasiquote only expands the parts of a template that will be
+// evaluated: those unquoted at the template's own nesting depth.
+func expandQuasiquote(scope *Scope, shadowed bound, form interface{}, depth int) (interface{}, error) {
+    list, ok := form.(List)
+    if !ok || len(list) == 0 {
+        return form, nil
+    }
+    if err := scope.nest(form); err != nil {
+        return nil, err
+    }
+    defer scope.unnest()
+    if sym, ok := list[0].(Symbol); ok && len(list) == 2 {
+        switch sym.Str() {
+        case "quasiquote":
+            return expandTailQuasiquote(scope, shadowed, list, depth+1)
+        case "unquote", "unquote-splicing":
+            if depth == 1 {
+                return expandTail(scope, shadowed, list, 1)
+            }
+            return expandTailQuasiquote(scope, shadowed, list, depth-1)
+        }
+    }
+    return expandTailQuasiquote(scope, shadowed, list, depth)
+}
+
+func expandTailQuasiquote(scope *Scope, shadowed bound, list List, depth int) (List, error) {
+    output := List{}
+    for _, element := range list {
+        expanded, err := expandQuasiquote(scope, shadowed, element, depth)
+        if err != nil {
+            return nil, err
+        }
+        output = append(output, expanded)
+    }
+    return keepPositions(output, list), nil
+}
+
+func macroexpand1(scope *Scope, params List) (interface{}, error) {
+    if len(params) != 1 {
+        return nil, errorAtCall(ARITY_ERROR, params, "MACROEXPAND-1 requires exactly 1 parameter; you have %v - %v", len(params), Write(params))
+    }
+    expanded, _, err := expand1(scope, nil, params[0])
+    return expanded, err
+}
+
+// macroexpand expands the form itself until it is no longer a macro call,
+// but doesn't look inside it.
+func macroexpand(scope *Scope, params List) (interface{}, error) {
+    if len(params) != 1 {
+        return nil, errorAtCall(ARITY_ERROR, params, "MACROEXPAND requires exactly 1 parameter; you have %v - %v", len(params), Write(params))
+    }
+    form := params[0]
+    for {
+        expanded, again, err := expand1(scope, nil, form)
+        if err != nil || !again {
+            return expanded, err
+        }
+        form = expanded
+    }
+}
+
+// quasiquote builds its template like quote does, except that (unquote x)
+// is replaced by the value of x and (unquote-splicing xs) by the elements of
+// the list xs. Nested quasiquotes need one unquote per level.
+func quasiquote(scope *Scope, params List) (interface{}, error) {
+    if len(params) != 1 {
+        return nil, errorAtCall(ARITY_ERROR, params, "QUASIQUOTE takes exactly 1 argument; you have %v - %v", len(params), Write(params))
+    }
+    return fillTemplate(scope, params[0], 1)
+}
+
+func unquoted(form interface{}) (string, interface{}, bool) {
+    list, ok := form.(List)
+    if !ok || len(list) != 2 {
+        return "", nil, false
+    }
+    sym, ok := list[0].(Symbol)
+    if !ok {
+        return "", nil, false
+    }
+    switch sym.Str() {
+    case "unquote", "unquote-splicing", "quasiquote":
+        return sym.Str(), list[1], true
+    }
+    return "", nil, false
+}
+
+// fillTemplate fills in one part of a quasiquote template. A dotted
+// unquote like `(1 . ,x) reads as the list (1 unquote x), since (unquote x)
+// is itself a list; as in R7RS, an unquote in next-to-last place like that
+// is the tail of the result, so it can be an improper list.
+func fillTemplate(scope *Scope, template interface{}, depth int) (interface{}, error) {
+    if pair, ok := template.(*Pair); ok {
+        car, err := fillTemplate(scope, pair.car, depth)
+        if err != nil {
+            return nil, err
+        }
+        cdr, err := fillTemplate(scope, pair.cdr, depth)
+        if err != nil {
+            return nil, err
+        }
+        return consOnto(car, cdr), nil
+    }
+    list, ok := template.(List)
+    if !ok {
+        return template, nil
+    }
+    if kind, arg, ok := unquoted(list); ok {
+        switch {
+        case kind == "quasiquote":
+            depth++
+        case kind == "unquote" && depth == 1:
+            return GetValue(scope, arg)
+        case kind == "unquote-splicing" && depth == 1:
+            return nil, NewError(EVAL_ERROR, list, "UNQUOTE-SPLICING must be inside a list")
+        default:
+            depth--
+        }
+        inner, err := fillTemplate(scope, arg, depth)
+        if err != nil {
+            return nil, err
+        }
+        return List{list[0], inner}, nil
+    }
+    output := List{}
+    for i, element := range list {
+        if sym, ok := element.(Symbol); ok && sym.Str() == "unquote" && i > 0 && i == len(list) - 2 {
+            tail, err := fillTemplate(scope, List{element, list[i+1]}, depth)
+            if err != nil {
+                return nil, err
+            }
+            for j := len(output) - 1; j >= 0; j-- {
+                tail = consOnto(output[j], tail)
+            }
+            return tail, nil
+        }
+        if kind, arg, ok := unquoted(element); ok && kind == "unquote-splicing" && depth == 1 {
+            value, err := GetValue(scope, arg)
+            if err != nil {
+                return nil, err
+            }
+            spliced, ok := value.(List)
+            if !ok && value != nil {
+                return nil, NewError(TYPE_ERROR, element, "UNQUOTE-SPLICING expects a list; found %v", Write(value))
+            }
+            output = append(output, spliced...)
+            continue
+        }
+        filled, err := fillTemplate(scope, element, depth)
+        if err != nil {
+            return nil, err
+        }
+        output = append(output, filled)
+    }
+    return output, nil
+}
+
+var gensymCounter uint64
+
+// gensym makes a fresh, uninterned symbol for macros to use as a variable
+// name that can't capture, or be captured by, names in the code they're
+// given. It prints as something like G__12, but typing G__12 gives a
+// different symbol.
+func gensym(_ *Scope, params List) (interface{}, error) {
+    prefix := "G"
+    if len(params) > 0 {
+        switch p := params[0].(type) {
+        case string:
+            prefix = p
+        case Symbol:
+            prefix = p.Str()
+        }
+    }
+    id := atomic.AddUint64(&gensymCounter, 1)
+    return Symbol{fmt.Sprintf("%v__%v", prefix, id), id}, nil
+}
@@ -0,0 +1,302 @@
+package glisp
+
+import (
+    "errors"
+    "math"
+    "math/big"
+    "strconv"
+    "strings"
+)
+
+// Numbers are int64 until they overflow, then *big.Int. Exact division
+// makes *big.Rat, and anything touching a float64 becomes a float64. Results
+// are always normalized back down to the narrowest exact type.
+const (
+    intRank = iota
+    bigRank
+    ratRank
+    floatRank
+)
+
+func isNumber(x interface{}) bool {
+    return rank(x) >= 0
+}
+
+func rank(x interface{}) int {
+    switch x.(type) {
+    case int64:
+        return intRank
+    case *big.Int:
+        return bigRank
+    case *big.Rat:
+        return ratRank
+    case float64:
+        return floatRank
+    }
+    return -1
+}
+
+func toBig(x interface{}) *big.Int {
+    switch n := x.(type) {
+    case int64:
+        return big.NewInt(n)
+    case *big.Int:
+        return n
+    }
+    return nil
+}
+
+func toRat(x interface{}) *big.Rat {
+    switch n := x.(type) {
+    case int64:
+        return new(big.Rat).SetInt64(n)
+    case *big.Int:
+        return new(big.Rat).SetInt(n)
+    case *big.Rat:
+        return n
+    }
+    return nil
+}
+
+func toFloat(x interface{}) float64 {
+    switch n := x.(type) {
+    case int64:
+        return float64(n)
+    case *big.Int:
+        f, _ := new(big.Float).SetInt(n).Float64()
+        return f
+    case *big.Rat:
+        f, _ := n.Float64()
+        return f
+    case float64:
+        return n
+    }
+    return math.NaN()
+}
+
+func normalize(x interface{}) interface{} {
+    switch n := x.(type) {
+    case *big.Int:
+        if n.IsInt64() {
+            return n.Int64()
+        }
+    case *big.Rat:
+        if n.IsInt() {
+            return normalize(new(big.Int).Set(n.Num()))
+        }
+    }
+    return x
+}
+
+func addNumbers(a, b interface{}) interface{} {
+    switch maxRank(a, b) {
+    case intRank:
+        x, y := a.(int64), b.(int64)
+        if sum := x + y; (sum > x) == (y > 0) {
+            return sum
+        }
+        return normalize(new(big.Int).Add(toBig(a), toBig(b)))
+    case bigRank:
+        return normalize(new(big.Int).Add(toBig(a), toBig(b)))
+    case ratRank:
+        return normalize(new(big.Rat).Add(toRat(a), toRat(b)))
+    }
+    return toFloat(a) + toFloat(b)
+}
+
+func subNumbers(a, b interface{}) interface{} {
+    switch maxRank(a, b) {
+    case intRank:
+        x, y := a.(int64), b.(int64)
+        if diff := x - y; (diff < x) == (y > 0) {
+            return diff
+        }
+        return normalize(new(big.Int).Sub(toBig(a), toBig(b)))
+    case bigRank:
+        return normalize(new(big.Int).Sub(toBig(a), toBig(b)))
+    case ratRank:
+        return normalize(new(big.Rat).Sub(toRat(a), toRat(b)))
+    }
+    return toFloat(a) - toFloat(b)
+}
+
+func mulNumbers(a, b interface{}) interface{} {
+    switch maxRank(a, b) {
+    case intRank:
+        x, y := a.(int64), b.(int64)
+        product := x * y
+        if x == 0 || (product / x == y && !(x == -1 && y == math.MinInt64)) {
+            return product
+        }
+        return normalize(new(big.Int).Mul(toBig(a), toBig(b)))
+    case bigRank:
+        return normalize(new(big.Int).Mul(toBig(a), toBig(b)))
+    case ratRank:
+        return normalize(new(big.Rat).Mul(toRat(a), toRat(b)))
+    }
+    return toFloat(a) * toFloat(b)
+}
+
+// quoNumbers divides exactly: two integers give a rational unless the
+// division comes out even. The caller checks for an exact zero divisor.
+func quoNumbers(a, b interface{}) interface{} {
+    if maxRank(a, b) == floatRank {
+        return toFloat(a) / toFloat(b)
+    }
+    return normalize(new(big.Rat).Quo(toRat(a), toRat(b)))
+}
+
+func isExactZero(x interface{}) bool {
+    return rank(x) < floatRank && toRat(x).Sign() == 0
+}
+
+func isInteger(x interface{}) bool {
+    return rank(x) == intRank || rank(x) == bigRank
+}
+
+// remNumbers and modNumbers only take integers. rem takes the sign of the
+// dividend and mod the sign of the divisor.
+func remNumbers(a, b interface{}) interface{} {
+    if maxRank(a, b) == intRank && !(a.(int64) == math.MinInt64 && b.(int64) == -1) {
+        return a.(int64) % b.(int64)
+    }
+    return normalize(new(big.Int).Rem(toBig(a), toBig(b)))
+}
+
+func modNumbers(a, b interface{}) interface{} {
+    r := remNumbers(a, b)
+    if compareNumbers(r, int64(0)) != 0 && (compareNumbers(r, int64(0)) < 0) != (compareNumbers(b, int64(0)) < 0) {
+        return addNumbers(r, b)
+    }
+    return r
+}
+
+// compareNumbers orders a and b exactly, even a float against an exact
+// number, which toFloat would round. NaN isn't ordered at all: it compares
+// as 0 with everything, so callers that care check isNaN first.
+func compareNumbers(a, b interface{}) int {
+    switch maxRank(a, b) {
+    case intRank:
+        x, y := a.(int64), b.(int64)
+        if x < y {
+            return -1
+        } else if x > y {
+            return 1
+        }
+        return 0
+    case bigRank:
+        return toBig(a).Cmp(toBig(b))
+    case ratRank:
+        return toRat(a).Cmp(toRat(b))
+    }
+    if rank(a) == floatRank && rank(b) == floatRank {
+        return compareFloats(a.(float64), b.(float64))
+    }
+    x, xok := exactValue(a)
+    y, yok := exactValue(b)
+    switch {
+    case xok && yok:
+        return x.Cmp(y)
+    case xok:
+        // b is infinite or NaN, and beyond any finite a.
+        return compareFloats(0, toFloat(b))
+    case yok:
+        return compareFloats(toFloat(a), 0)
+    }
+    return compareFloats(toFloat(a), toFloat(b))
+}
+
+func compareFloats(x, y float64) int {
+    if x < y {
+        return -1
+    } else if x > y {
+        return 1
+    }
+    return 0
+}
+
+// exactValue is x as an exact rational, if it is finite.
+func exactValue(x interface{}) (*big.Rat, bool) {
+    if f, ok := x.(float64); ok {
+        if math.IsInf(f, 0) || math.IsNaN(f) {
+            return nil, false
+        }
+        return new(big.Rat).SetFloat64(f), true
+    }
+    return toRat(x), true
+}
+
+func isNaN(x interface{}) bool {
+    f, ok := x.(float64)
+    return ok && math.IsNaN(f)
+}
+
+func maxRank(a, b interface{}) int {
+    if rank(a) > rank(b) {
+        return rank(a)
+    }
+    return rank(b)
+}
+
+// parseNumber reads a numeric literal: decimal integers, #x/0x hex, #b/0b
+// binary and #o/0o octal integers, n/d rationals, decimal floats with an
+// optional exponent, and +inf.0, -inf.0 and +nan.0. A float too big for
+// float64, like 1e400, reads as infinity. Go's digit separators aren't
+// allowed: 1_000 is a symbol.
+func parseNumber(s string) (interface{}, bool) {
+    switch s {
+    case "+inf.0":
+        return math.Inf(1), true
+    case "-inf.0":
+        return math.Inf(-1), true
+    case "+nan.0", "-nan.0":
+        return math.NaN(), true
+    }
+    body := s
+    sign := ""
+    if strings.HasPrefix(body, "-") || strings.HasPrefix(body, "+") {
+        sign, body = body[:1], body[1:]
+    }
+    base := 10
+    if len(body) > 2 {
+        switch strings.ToLower(body[:2]) {
+        case "#x", "0x":
+            base, body = 16, body[2:]
+        case "#b", "0b":
+            base, body = 2, body[2:]
+        case "#o", "0o":
+            base, body = 8, body[2:]
+        case "#d":
+            body = body[2:]
+        }
+    }
+    if base != 10 {
+        if n, ok := new(big.Int).SetString(sign+body, base); ok {
+            return normalize(n), true
+        }
+        return nil, false
+    }
+    if !startsWithDigit(body) && !(strings.HasPrefix(body, ".") && startsWithDigit(body[1:])) {
+        return nil, false
+    } else if strings.Contains(body, "_") {
+        return nil, false
+    }
+    if n, ok := new(big.Int).SetString(sign+body, 10); ok {
+        return normalize(n), true
+    }
+    if strings.Contains(body, "/") {
+        if r, ok := new(big.Rat).SetString(sign+body); ok {
+            return normalize(r), true
+        }
+        return nil, false
+    }
+    f, err := strconv.ParseFloat(sign+body, 64)
+    if err == nil || errors.Is(err, strconv.ErrRange) {
+        return f, true
+    }
+    return nil, false
+}
+
+func startsWithDigit(s string) bool {
+    return s != "" && s[0] >= '0' && s[0] <= '9'
+}
@@ -0,0 +1,142 @@
+package glisp
+
+import (
+    "math"
+    "math/big"
+    "testing"
+
+    . "github.com/tychofreeman/go-matchers"
+)
+
+func bigInt(s string) *big.Int {
+    n, _ := new(big.Int).SetString(s, 10)
+    return n
+}
+
+func TestParsesIntegerLiterals(t *testing.T) {
+    AssertThat(t, process(t, "42"), Equals(int64(42)))
+    AssertThat(t, process(t, "-42"), Equals(int64(-42)))
+    AssertThat(t, process(t, "+7"), Equals(int64(7)))
+}
+
+func TestParsesRadixLiterals(t *testing.T) {
+    AssertThat(t, process(t, "#x1F"), Equals(int64(31)))
+    AssertThat(t, process(t, "0xff"), Equals(int64(255)))
+    AssertThat(t, process(t, "#b101"), Equals(int64(5)))
+    AssertThat(t, process(t, "0o17"), Equals(int64(15)))
+    AssertThat(t, process(t, "-#x10"), Equals(int64(-16)))
+}
+
+func TestParsesFloatLiterals(t *testing.T) {
+    AssertThat(t, process(t, "1.5"), Equals(1.5))
+    AssertThat(t, process(t, ".5"), Equals(0.5))
+    AssertThat(t, process(t, "1e3"), Equals(1000.0))
+    AssertThat(t, process(t, "2.5E-1"), Equals(0.25))
+}
+
+func TestParsesRationalLiterals(t *testing.T) {
+    AssertThat(t, process(t, "1/3"), Equals(big.NewRat(1, 3)))
+    AssertThat(t, process(t, "4/2"), Equals(int64(2)))
+}
+
+func TestParsesHugeIntegersAsBigInts(t *testing.T) {
+    AssertThat(t, process(t, "123456789012345678901234567890"), Equals(bigInt("123456789012345678901234567890")))
+}
+
+func TestSymbolsThatLookNumericStaySymbols(t *testing.T) {
+    AssertThat(t, tokenize(t, "- + . e1 #xyz"), HasExactly(symbol("-"), symbol("+"), symbol("."), symbol("e1"), symbol("#xyz")))
+}
+
+func TestUnderscoresDoNotSeparateDigits(t *testing.T) {
+    AssertThat(t, tokenize(t, "1_000 1_000.5 1_0/3 #x1_0"), HasExactly(symbol("1_000"), symbol("1_000.5"), symbol("1_0/3"), symbol("#x1_0")))
+}
+
+func TestFloatsTooBigForFloat64AreInfinite(t *testing.T) {
+    AssertThat(t, process(t, "1e400"), Equals(math.Inf(1)))
+    AssertThat(t, process(t, "-1.5e400"), Equals(math.Inf(-1)))
+    AssertThat(t, process(t, "1e-400"), Equals(0.0))
+}
+
+func TestAdditionPromotesOnOverflow(t *testing.T) {
+    AssertThat(t, process(t, "(plus 9223372036854775807 1)"), Equals(bigInt("9223372036854775808")))
+    AssertThat(t, process(t, "(plus 9223372036854775808 -1)"), Equals(int64(9223372036854775807)))
+}
+
+func TestAdditionPromotesToRationalsAndFloats(t *testing.T) {
+    AssertThat(t, process(t, "(plus 1/3 1/6)"), Equals(big.NewRat(1, 2)))
+    AssertThat(t, process(t, "(plus 1/2 1/2)"), Equals(int64(1)))
+    AssertThat(t, process(t, "(plus 1 1/2 0.5)"), Equals(2.0))
+}
+
+func TestSymbolicPlusIsAnAlias(t *testing.T) {
+    AssertThat(t, process(t, "(+ 1 2 3)"), Equals(int64(6)))
+    AssertThat(t, process(t, "(+)"), Equals(int64(0)))
+}
+
+func TestSubtraction(t *testing.T) {
+    AssertThat(t, process(t, "(- 10 1 2)"), Equals(int64(7)))
+    AssertThat(t, process(t, "(- 5)"), Equals(int64(-5)))
+    AssertThat(t, process(t, "(- -9223372036854775808)"), Equals(bigInt("9223372036854775808")))
+}
+
+func TestMultiplication(t *testing.T) {
+    AssertThat(t, process(t, "(* 2 3 4)"), Equals(int64(24)))
+    AssertThat(t, process(t, "(* 4294967296 4294967296)"), Equals(bigInt("18446744073709551616")))
+    AssertThat(t, process(t, "(* 1/2 3)"), Equals(big.NewRat(3, 2)))
+    AssertThat(t, process(t, "(mult 6 7)"), Equals(int64(42)))
+}
+
+func TestDivisionIsExact(t *testing.T) {
+    AssertThat(t, process(t, "(/ 6 3)"), Equals(int64(2)))
+    AssertThat(t, process(t, "(/ 1 3)"), Equals(big.NewRat(1, 3)))
+    AssertThat(t, process(t, "(/ 4)"), Equals(big.NewRat(1, 4)))
+    AssertThat(t, process(t, "(/ 1.0 4)"), Equals(0.25))
+    AssertThat(t, processError(t, "(/ 1 0)").Kind, Equals(EVAL_ERROR))
+}
+
+func TestModAndRem(t *testing.T) {
+    AssertThat(t, process(t, "(rem -7 2)"), Equals(int64(-1)))
+    AssertThat(t, process(t, "(mod -7 2)"), Equals(int64(1)))
+    AssertThat(t, process(t, "(mod 7 -2)"), Equals(int64(-1)))
+    AssertThat(t, processError(t, "(mod 7 1.5)").Kind, Equals(TYPE_ERROR))
+}
+
+func TestComparisonsChain(t *testing.T) {
+    AssertThat(t, process(t, "(< 1 2 3)"), IsTrue)
+    AssertThat(t, process(t, "(< 1 3 2)"), IsFalse)
+    AssertThat(t, process(t, "(>= 3 3 1)"), IsTrue)
+    AssertThat(t, process(t, "(> 1/2 0.25)"), IsTrue)
+    AssertThat(t, process(t, "(<= 2 1)"), IsFalse)
+    AssertThat(t, process(t, "(= 1 1.0 2/2)"), IsTrue)
+}
+
+func TestMinMaxAndAbs(t *testing.T) {
+    AssertThat(t, process(t, "(min 3 1 2)"), Equals(int64(1)))
+    AssertThat(t, process(t, "(max 3 1 2.0)"), Equals(3.0))
+    AssertThat(t, process(t, "(abs -5)"), Equals(int64(5)))
+    AssertThat(t, process(t, "(abs -1/2)"), Equals(big.NewRat(1, 2)))
+}
+
+func TestNaNIsUnordered(t *testing.T) {
+    AssertThat(t, process(t, "(= +nan.0 1)"), IsFalse)
+    AssertThat(t, process(t, "(= +nan.0 +nan.0)"), IsFalse)
+    AssertThat(t, process(t, "(<= +nan.0 1)"), IsFalse)
+    AssertThat(t, process(t, "(< 1 2 +nan.0)"), IsFalse)
+    AssertThat(t, process(t, "(eqv? +nan.0 1.0)"), IsFalse)
+    AssertThat(t, math.IsNaN(process(t, "(max 1 +nan.0)").(float64)), IsTrue)
+    AssertThat(t, math.IsNaN(process(t, "(min +nan.0 1)").(float64)), IsTrue)
+}
+
+func TestExactAndInexactCompareExactly(t *testing.T) {
+    AssertThat(t, process(t, "(= 9007199254740993 9007199254740992.0)"), IsFalse)
+    AssertThat(t, process(t, "(> 9007199254740993 9007199254740992.0)"), IsTrue)
+    AssertThat(t, process(t, "(= 1/3 0.3333333333333333)"), IsFalse)
+    AssertThat(t, process(t, "(= 1/2 0.5)"), IsTrue)
+    AssertThat(t, process(t, "(< 100000000000000000000000000000 +inf.0)"), IsTrue)
+    AssertThat(t, process(t, "(> 1/2 -inf.0)"), IsTrue)
+}
+
+func TestArithmeticOnNonNumbersIsATypeError(t *testing.T) {
+    AssertThat(t, processError(t, "(+ 1 \"two\")").Kind, Equals(TYPE_ERROR))
+    AssertThat(t, processError(t, "(< 1 (quote a))").Kind, Equals(TYPE_ERROR))
+}
@@ -0,0 +1,48 @@
+package glisp
+
+import (
+    "io"
+    "strings"
+)
+
+// outputBuiltins are the builtins that print. They look up where to print
+// each time they are called, so WithOutput can change it after they exist.
+func outputBuiltins(out func() io.Writer) map[string]interface{} {
+    emit := func(params List, text string) (interface{}, error) {
+        if _, err := io.WriteString(out(), text); err != nil {
+            return nil, NewError(EVAL_ERROR, params, "Could not write output: %v", err)
+        }
+        return nil, nil
+    }
+    return map[string]interface{} {
+        "write": Function(func(_ *Scope, params List) (interface{}, error) {
+            if err := exactly("write", params, 1); err != nil {
+                return nil, err
+            }
+            return emit(params, Write(params[0]))
+        }),
+        "display": Function(func(_ *Scope, params List) (interface{}, error) {
+            if err := exactly("display", params, 1); err != nil {
+                return nil, err
+            }
+            return emit(params, Display(params[0]))
+        }),
+        "newline": Function(func(_ *Scope, params List) (interface{}, error) {
+            if err := exactly("newline", params, 0); err != nil {
+                return nil, err
+            }
+            return emit(params, "\n")
+        }),
+        // p is for debugging: it writes all of its params on one line.
+        "p": Function(func(_ *Scope, params List) (interface{}, error) {
+            written := []string{}
+            for _, p := range params {
+                written = append(written, Write(p))
+            }
+            if _, err := emit(params, strings.Join(written, " ") + "\n"); err != nil {
+                return nil, err
+            }
+            return List{}, nil
+        }),
+    }
+}
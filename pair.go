@@ -0,0 +1,126 @@
+package glisp
+
+// Pair is a cons cell. Proper lists are still Lists; a Pair is what cons
+// makes when its second argument isn't a List, and what (a . b) reads as.
+// A chain of Pairs that doesn't end in a List is an improper list, like
+// (1 2 . 3).
+type Pair struct {
+    car Value
+    cdr Value
+}
+
+func NewPair(car, cdr Value) *Pair {
+    return &Pair{car, cdr}
+}
+
+func (p *Pair) Car() Value {
+    return p.car
+}
+
+func (p *Pair) Cdr() Value {
+    return p.cdr
+}
+
+// consOnto puts head in front of tail: a List if tail is one, so that
+// (cons 1 '(2)) is still the list (1 2), and a Pair otherwise. A List keeps
+// its elements in one slice, so the new List is a copy that doesn't share
+// tail: (eq? xs (cdr (cons 0 xs))) is #f, and a later set-car! on xs
+// doesn't show through it.
+func consOnto(head, tail Value) Value {
+    if list, ok := tail.(List); ok {
+        return append(List{head}, list...)
+    }
+    return &Pair{head, tail}
+}
+
+// split takes apart a Pair or a non-empty List, which are the values with a
+// car and a cdr.
+func split(value Value) (car, cdr Value, ok bool) {
+    switch v := value.(type) {
+    case *Pair:
+        return v.car, v.cdr, true
+    case List:
+        if len(v) > 0 {
+            return v[0], v.Rest(), true
+        }
+    }
+    return nil, nil, false
+}
+
+// walkPairs calls each with the car of every Pair in the chain that starts
+// at value, and returns whatever the chain ends in. set-cdr! can make a
+// chain loop back on itself, so it follows the chain with a second pointer
+// at half speed, and reports false if the first one ever catches it up.
+func walkPairs(value Value, each func(car Value)) (Value, bool) {
+    slow := value
+    for i := 0; ; i++ {
+        p, ok := value.(*Pair)
+        if !ok {
+            return value, true
+        }
+        each(p.car)
+        value = p.cdr
+        if i % 2 == 1 {
+            slow = slow.(*Pair).cdr
+        }
+        if next, ok := value.(*Pair); ok && next == slow {
+            return nil, false
+        }
+    }
+}
+
+// listCell is where a non-empty List's elements are. Along with how many
+// there are, that tells it apart from every other List.
+type listCell struct {
+    first *interface{}
+    n int
+}
+
+// cell identifies a list or pair, for code that has to notice when it
+// comes back to one it has already seen: a *Pair is itself, and a List is
+// its listCell. Nothing else has one.
+func cell(value Value) (interface{}, bool) {
+    switch v := value.(type) {
+    case *Pair:
+        return v, true
+    case List:
+        if len(v) > 0 {
+            return listCell{&v[0], len(v)}, true
+        }
+    }
+    return nil, false
+}
+
+// setCar replaces the first element of a pair or list in place, so every
+// reference to it sees the change.
+func setCar(_ *Scope, params List) (interface{}, error) {
+    if err := exactly("set-car!", params, 2); err != nil {
+        return nil, err
+    }
+    switch v := params[0].(type) {
+    case *Pair:
+        v.car = params[1]
+        return List{}, nil
+    case List:
+        if len(v) > 0 {
+            v[0] = params[1]
+            return List{}, nil
+        }
+    }
+    return nil, NewError(TYPE_ERROR, params, "set-car! expects a pair or non-empty list; found %v", Write(params[0]))
+}
+
+// setCdr only works on Pairs, whose cdr isn't a List: a List, including one
+// made by consing onto a List, keeps its elements in one slice, so its tail
+// can't be swapped for another.
+func setCdr(_ *Scope, params List) (interface{}, error) {
+    if err := exactly("set-cdr!", params, 2); err != nil {
+        return nil, err
+    }
+    p, ok := params[0].(*Pair)
+    if !ok {
+        return nil, NewError(TYPE_ERROR, params, "set-cdr! can only change a pair with a non-list cdr, like (1 . 2); %v is stored as a list, whose tail can't be replaced", Write(params[0]))
+    }
+    p.cdr = params[1]
+    return List{}, nil
+}
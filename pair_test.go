@@ -0,0 +1,110 @@
+package glisp
+
+import (
+    "testing"
+
+    . "github.com/tychofreeman/go-matchers"
+)
+
+func TestConsOntoAnAtomMakesAPair(t *testing.T) {
+    AssertThat(t, Write(process(t, "(cons 1 2)")), Equals("(1 . 2)"))
+    AssertThat(t, process(t, "(car (cons 1 2))"), Equals(int64(1)))
+    AssertThat(t, process(t, "(cdr (cons 1 2))"), Equals(int64(2)))
+}
+
+func TestConsOntoAListStillMakesAList(t *testing.T) {
+    AssertThat(t, process(t, "(cons 1 '(2 3))"), HasExactly(int64(1), int64(2), int64(3)))
+    AssertThat(t, process(t, "(cons 1 '())"), HasExactly(int64(1)))
+}
+
+func TestConsOfAtomsIsNotAList(t *testing.T) {
+    AssertThat(t, process(t, "(equal? (cons 1 2) '(1 2))"), IsFalse)
+    AssertThat(t, process(t, "(equal? (cons 1 2) '(1 . 2))"), IsTrue)
+    AssertThat(t, process(t, "(atom (cons 1 2))"), IsFalse)
+}
+
+func TestConsTakesExactlyTwoArguments(t *testing.T) {
+    AssertThat(t, processError(t, "(cons 1)").Kind, Equals(ARITY_ERROR))
+    AssertThat(t, processError(t, "(cons 1 2 3)").Kind, Equals(ARITY_ERROR))
+}
+
+func TestImproperListsWalkWithCarAndCdr(t *testing.T) {
+    AssertThat(t, Write(process(t, "(cons 1 (cons 2 3))")), Equals("(1 2 . 3)"))
+    AssertThat(t, Write(process(t, "(cdr '(1 2 . 3))")), Equals("(2 . 3)"))
+    AssertThat(t, process(t, "(cdr (cdr '(1 2 . 3)))"), Equals(int64(3)))
+}
+
+func TestSetCarAndSetCdrChangePairsInPlace(t *testing.T) {
+    AssertThat(t, Write(process(t, "(def p (cons 1 2)) (def q p) (set-car! p 10) (set-cdr! p 20) q")), Equals("(10 . 20)"))
+    AssertThat(t, Write(process(t, "(def p (cons 1 2)) (set-cdr! p '(3 4)) p")), Equals("(1 3 4)"))
+    AssertThat(t, process(t, "(def p (cons 1 2)) (set-cdr! p '(3 4)) (equal? p '(1 3 4))"), IsTrue)
+}
+
+func TestSetCarWorksOnLists(t *testing.T) {
+    AssertThat(t, process(t, "(def xs (cons 1 '(2))) (set-car! xs 5) xs"), HasExactly(int64(5), int64(2)))
+}
+
+func TestSetCdrNeedsAPair(t *testing.T) {
+    AssertThat(t, processError(t, "(set-cdr! (cons 1 '(2)) 3)").Kind, Equals(TYPE_ERROR))
+    AssertThat(t, processError(t, "(set-car! '() 3)").Kind, Equals(TYPE_ERROR))
+}
+
+func TestSetCdrExplainsWhyAListCannotChange(t *testing.T) {
+    err := processError(t, "(def p (cons 1 '())) (set-cdr! p 2)")
+    AssertThat(t, err.Message, Equals("set-cdr! can only change a pair with a non-list cdr, like (1 . 2); (1) is stored as a list, whose tail can't be replaced"))
+    AssertThat(t, processError(t, "(set-cdr! (list 1 2) 3)").Kind, Equals(TYPE_ERROR))
+}
+
+func TestConsOntoAListCopiesIt(t *testing.T) {
+    AssertThat(t, process(t, "(def a (list 1 2)) (eq? a (cdr (cons 0 a)))"), IsFalse)
+    AssertThat(t, Write(process(t, "(def a (list 1 2)) (def b (cons 0 a)) (set-car! a 9) b")), Equals("(0 1 2)"))
+    AssertThat(t, process(t, "(def p (cons 1 2)) (eq? p (cdr (cons 0 p)))"), IsTrue)
+}
+
+func TestDottedParameterListsStillCollectTheRest(t *testing.T) {
+    AssertThat(t, process(t, "((lambda (a b . rest) rest) 1 2 3 4)"), HasExactly(int64(3), int64(4)))
+}
+
+func TestImproperListsCannotBeEvaluated(t *testing.T) {
+    AssertThat(t, processError(t, "(+ 1 . 2)").Kind, Equals(EVAL_ERROR))
+}
+
+func TestApplySpreadsAListMadeOfPairs(t *testing.T) {
+    AssertThat(t, process(t, "(def p (cons 1 2)) (set-cdr! p '(3)) (apply + p)"), Equals(int64(4)))
+    AssertThat(t, processError(t, "(apply + 1 (cons 2 3))").Kind, Equals(TYPE_ERROR))
+}
+
+func TestAProperListMadeOfPairsCanBeEvaluated(t *testing.T) {
+    value, err := GetValue(New().global, NewPair(symbol("+"), List{int64(1), int64(2)}))
+    AssertThat(t, err, Equals(nil))
+    AssertThat(t, value, Equals(int64(3)))
+}
+
+func TestQuasiquoteFillsADottedUnquote(t *testing.T) {
+    AssertThat(t, Write(process(t, "`(1 . ,(+ 1 1))")), Equals("(1 . 2)"))
+    AssertThat(t, Write(process(t, "`(1 2 . ,(list 3 4))")), Equals("(1 2 3 4)"))
+    AssertThat(t, Write(process(t, "(let ((x 5)) `((,x . a) . ,x))")), Equals("((5 . a) . 5)"))
+    AssertThat(t, Write(process(t, "``(1 . ,,(+ 1 1))")), Equals("(quasiquote (1 unquote 2))"))
+}
+
+func TestCircularListsAreNotFollowedForever(t *testing.T) {
+    p := "(def p (cons 1 2)) (set-cdr! p p) "
+    AssertThat(t, process(t, p + "(equal? p p)"), IsTrue)
+    AssertThat(t, Write(process(t, p + "p")), Equals("#0=(1 . #0#)"))
+    AssertThat(t, processError(t, p + "(length p)").Kind, Equals(TYPE_ERROR))
+    AssertThat(t, processError(t, p + "(apply + p)").Kind, Equals(TYPE_ERROR))
+    AssertThat(t, processError(t, p + "(member 5 p)").Kind, Equals(TYPE_ERROR))
+    AssertThat(t, processError(t, p + "(+ 1 p)").Kind, Equals(TYPE_ERROR))
+    value, err := GetValue(New().global, process(t, p + "p"))
+    AssertThat(t, value, Equals(nil))
+    AssertThat(t, err.(*Error).Kind, Equals(EVAL_ERROR))
+}
+
+func TestCircularListsCompareAndPrintAllTheWayRound(t *testing.T) {
+    AssertThat(t, process(t, "(def p (cons 1 2)) (set-cdr! p p) (def q (cons 1 (cons 1 2))) (set-cdr! (cdr q) q) (equal? p q)"), IsTrue)
+    AssertThat(t, process(t, "(def p (cons 1 2)) (set-cdr! p p) (def q (cons 1 (cons 2 2))) (set-cdr! (cdr q) q) (equal? p q)"), IsFalse)
+    AssertThat(t, Write(process(t, "(def p (cons 1 2)) (set-cdr! p (cons 2 p)) p")), Equals("#0=(1 2 . #0#)"))
+    AssertThat(t, Write(process(t, "(def p (cons 1 2)) (set-cdr! p (cons 2 (cdr p))) (set-cdr! (cdr p) (cdr p)) p")), Equals("(1 . #0=(2 . #0#))"))
+    AssertThat(t, Write(process(t, "(def l (list 1 2)) (set-car! l l) l")), Equals("#0=(#0# 2)"))
+    AssertThat(t, Write(process(t, "(def p (cons 1 2)) (set-cdr! p p) (list p p)")), Equals("(#0=(1 . #0#) #0#)"))
+}
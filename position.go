@@ -0,0 +1,78 @@
+package glisp
+
+import (
+    "runtime"
+    "sync"
+    "weak"
+)
+
+// positions records where the reader read each element of each List it
+// makes, keyed by the element's address. The tails that Rest and cdr cut
+// from a List share its elements, and so its positions; a copy, or a List
+// built some other way, has none. The keys are weak, and a List's entries
+// are dropped once the List is garbage collected, so reading doesn't leak.
+var positions = struct {
+    sync.Mutex
+    table map[weak.Pointer[interface{}]]Pos
+}{table: map[weak.Pointer[interface{}]]Pos{}}
+
+// recordPositions notes that the ith element of list was read at elems[i],
+// and returns list.
+func recordPositions(list List, elems []Pos) List {
+    if len(list) == 0 {
+        return list
+    }
+    keys := make([]weak.Pointer[interface{}], len(list))
+    positions.Lock()
+    for i := range list {
+        keys[i] = weak.Make(&list[i])
+        positions.table[keys[i]] = elems[i]
+    }
+    positions.Unlock()
+    runtime.AddCleanup(&list[0], forgetPositions, keys)
+    return list
+}
+
+func forgetPositions(keys []weak.Pointer[interface{}]) {
+    positions.Lock()
+    defer positions.Unlock()
+    for _, key := range keys {
+        delete(positions.table, key)
+    }
+}
+
+// recorded looks up where the ith element of list was read.
+func recorded(list List, i int) (Pos, bool) {
+    positions.Lock()
+    defer positions.Unlock()
+    pos, ok := positions.table[weak.Make(&list[i])]
+    return pos, ok
+}
+
+// PositionIn reports where the ith element of list was read. Unlike
+// PositionOf it can locate numbers, strings and symbols, which don't
+// carry a position of their own. Elements of a List the reader didn't
+// make are located by PositionOf.
+func PositionIn(list List, i int) Pos {
+    if pos, ok := recorded(list, i); ok {
+        return pos
+    }
+    return PositionOf(list[i])
+}
+
+// keepPositions gives rebuilt, a copy of list with some of its elements
+// replaced, the positions recorded for list, and returns it.
+func keepPositions(rebuilt List, list List) List {
+    if len(rebuilt) != len(list) || len(list) == 0 {
+        return rebuilt
+    }
+    elems := make([]Pos, len(list))
+    for i := range list {
+        pos, ok := recorded(list, i)
+        if !ok {
+            return rebuilt
+        }
+        elems[i] = pos
+    }
+    return recordPositions(rebuilt, elems)
+}
@@ -0,0 +1,235 @@
+package glisp
+
+import (
+    "fmt"
+    "math"
+    "math/big"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// Write renders value as source text that Tokenize reads back as the same
+// value. Functions and macros, which have no source form, come out as
+// #<...>, and lists nested deeper than Tokenize will read come out as ...
+func Write(value Value) string {
+    return render(value, true)
+}
+
+// Display is Write for people: strings appear without quotes or escapes.
+func Display(value Value) string {
+    return render(value, false)
+}
+
+// printer remembers which lists and pairs it is in the middle of printing,
+// so that it notices when a circular one leads back to one of them. Those
+// are written with datum labels, as R7RS does: a pair whose cdr is itself
+// is #0=(1 . #0#). Which ones need labels is only known after a first pass,
+// so a value with any is printed twice.
+type printer struct {
+    b strings.Builder
+    write bool
+    active map[interface{}]bool
+    // shared holds the cells a cycle leads back to. Each is 0 until the
+    // second pass gives it a label, and label+1 after that.
+    shared map[interface{}]int
+    labelling bool
+    labels int
+    // depth is how many lists and pairs deep the printer is.
+    depth int
+}
+
+func render(value Value, write bool) string {
+    p := &printer{write: write, active: map[interface{}]bool{}}
+    p.value(value)
+    if p.shared != nil {
+        p.b.Reset()
+        p.labelling = true
+        p.value(value)
+    }
+    return p.b.String()
+}
+
+// enter starts on the list or pair c, and reports whether to print what is
+// in it. It doesn't if c has a label already, or if this is the first pass
+// and c is being printed further out.
+func (p *printer) enter(c interface{}) bool {
+    if n, ok := p.shared[c]; ok && p.labelling {
+        if n > 0 {
+            fmt.Fprintf(&p.b, "#%v#", n-1)
+            return false
+        }
+        p.labels++
+        p.shared[c] = p.labels
+        fmt.Fprintf(&p.b, "#%v=", p.labels-1)
+    } else if p.active[c] {
+        if p.shared == nil {
+            p.shared = map[interface{}]int{}
+        }
+        p.shared[c] = 0
+        return false
+    }
+    p.active[c] = true
+    return true
+}
+
+// tooDeep goes into one more list or pair, unless that would nest deeper
+// than maxNesting, in which case it writes ... in its place. out undoes it.
+func (p *printer) tooDeep() bool {
+    if p.depth >= maxNesting {
+        p.b.WriteString("...")
+        return true
+    }
+    p.depth++
+    return false
+}
+
+func (p *printer) out() {
+    p.depth--
+}
+
+// leads tells the loop through a chain of pairs to stop at next, which
+// has to be written after a dot since a cycle leads to it.
+func (p *printer) leads(next *Pair) bool {
+    if p.labelling {
+        _, ok := p.shared[next]
+        return ok
+    }
+    return p.active[next]
+}
+
+func (p *printer) value(value Value) {
+    b := &p.b
+    switch v := value.(type) {
+    case nil:
+        b.WriteString("nil")
+    case bool:
+        if v {
+            b.WriteString("#t")
+        } else {
+            b.WriteString("#f")
+        }
+    case string:
+        printString(b, v, p.write)
+    case Symbol:
+        b.WriteString(v.Str())
+    case int64:
+        b.WriteString(strconv.FormatInt(v, 10))
+    case *big.Int:
+        b.WriteString(v.String())
+    case *big.Rat:
+        b.WriteString(v.RatString())
+    case float64:
+        b.WriteString(formatFloat(v))
+    case List:
+        if p.tooDeep() {
+            return
+        }
+        defer p.out()
+        c, ok := cell(v)
+        if ok && !p.enter(c) {
+            return
+        }
+        b.WriteString("(")
+        for i, element := range v {
+            if i > 0 {
+                b.WriteString(" ")
+            }
+            p.value(element)
+        }
+        b.WriteString(")")
+        delete(p.active, c)
+    case *Pair:
+        if p.tooDeep() {
+            return
+        }
+        defer p.out()
+        if p.enter(v) {
+            p.pair(v)
+            delete(p.active, v)
+        }
+    case *builtin, Function, NonEvaluatingFunction:
+        b.WriteString("#<builtin>")
+    case fmt.Stringer:
+        b.WriteString(v.String())
+    default:
+        fmt.Fprintf(b, "#<%T %v>", v, v)
+    }
+}
+
+// formatFloat always leaves a float looking like one, so that 2.0 doesn't
+// read back as the integer 2.
+func formatFloat(f float64) string {
+    switch {
+    case math.IsInf(f, 1):
+        return "+inf.0"
+    case math.IsInf(f, -1):
+        return "-inf.0"
+    case math.IsNaN(f):
+        return "+nan.0"
+    }
+    s := strconv.FormatFloat(f, 'g', -1, 64)
+    if !strings.ContainsAny(s, ".e") {
+        s += ".0"
+    }
+    return s
+}
+
+func printString(b *strings.Builder, s string, write bool) {
+    if !write {
+        b.WriteString(s)
+        return
+    }
+    b.WriteString("\"")
+    for _, c := range s {
+        switch c {
+        case '"':
+            b.WriteString("\\\"")
+        case '\\':
+            b.WriteString("\\\\")
+        case '\n':
+            b.WriteString("\\n")
+        case '\t':
+            b.WriteString("\\t")
+        case '\r':
+            b.WriteString("\\r")
+        default:
+            if unicode.IsPrint(c) {
+                b.WriteRune(c)
+            } else {
+                fmt.Fprintf(b, "\\u{%x}", c)
+            }
+        }
+    }
+    b.WriteString("\"")
+}
+
+// pair writes a chain of pairs as one list, dotting only the final tail if
+// it isn't a List: (1 2 . 3).
+func (p *printer) pair(first *Pair) {
+    b := &p.b
+    b.WriteString("(")
+    p.value(first.car)
+    chain := []*Pair{}
+    var tail Value = first.cdr
+    for next, ok := tail.(*Pair); ok && !p.leads(next); next, ok = tail.(*Pair) {
+        p.active[next] = true
+        chain = append(chain, next)
+        b.WriteString(" ")
+        p.value(next.car)
+        tail = next.cdr
+    }
+    if list, ok := tail.(List); ok {
+        for _, element := range list {
+            b.WriteString(" ")
+            p.value(element)
+        }
+    } else {
+        b.WriteString(" . ")
+        p.value(tail)
+    }
+    b.WriteString(")")
+    for _, next := range chain {
+        delete(p.active, next)
+    }
+}
@@ -0,0 +1,96 @@
+package glisp
+
+import (
+    "bytes"
+    "math"
+    "math/big"
+    "testing"
+
+    . "github.com/tychofreeman/go-matchers"
+)
+
+func TestWritesAtoms(t *testing.T) {
+    AssertThat(t, Write(nil), Equals("nil"))
+    AssertThat(t, Write(true), Equals("#t"))
+    AssertThat(t, Write(false), Equals("#f"))
+    AssertThat(t, Write(symbol("abc")), Equals("abc"))
+    AssertThat(t, Write(int64(-12)), Equals("-12"))
+    AssertThat(t, Write(bigInt("123456789012345678901234567890")), Equals("123456789012345678901234567890"))
+    AssertThat(t, Write(big.NewRat(-1, 3)), Equals("-1/3"))
+}
+
+func TestWritesFloatsSoTheyStayFloats(t *testing.T) {
+    AssertThat(t, Write(2.0), Equals("2.0"))
+    AssertThat(t, Write(0.25), Equals("0.25"))
+    AssertThat(t, Write(1e21), Equals("1e+21"))
+    AssertThat(t, Write(math.Inf(-1)), Equals("-inf.0"))
+}
+
+func TestWritesStringsWithEscapes(t *testing.T) {
+    AssertThat(t, Write("a\"b\\c\nd\te\x01λ"), Equals(`"a\"b\\c\nd\te\u{1}λ"`))
+    AssertThat(t, Write("hi"), Equals(`"hi"`))
+}
+
+func TestDisplayLeavesStringsAlone(t *testing.T) {
+    AssertThat(t, Display("a\"b\n"), Equals("a\"b\n"))
+    AssertThat(t, Display(List{"a", symbol("b"), List{int64(1)}}), Equals("(a b (1))"))
+}
+
+func TestWritesLists(t *testing.T) {
+    AssertThat(t, Write(List{}), Equals("()"))
+    AssertThat(t, Write(List{symbol("a"), "b", List{int64(1), 1.5}}), Equals(`(a "b" (1 1.5))`))
+}
+
+func TestWritesProcedures(t *testing.T) {
+    AssertThat(t, Write(process(t, "(lambda (x y) x)")), Equals("#<lambda (x y)>"))
+    AssertThat(t, Write(process(t, "car")), Equals("#<builtin>"))
+}
+
+func TestWrittenValuesReadBack(t *testing.T) {
+    source := `(a "q\"\\\n\u{7}" 1 -2/3 1.5 2.0 +inf.0 123456789012345678901234567890 #t #f nil (nested (list)) ())`
+    forms, err := TokenizeString(source)
+    if err != nil {
+        t.Fatal(err)
+    }
+    written := Write(forms[0])
+    again, err := TokenizeString(written)
+    if err != nil {
+        t.Fatal(err)
+    }
+    AssertThat(t, Write(again[0]), Equals(written))
+    values := process(t, "'" + written)
+    AssertThat(t, Write(values), Equals(written))
+}
+
+func TestWriteDisplayAndNewlineBuiltins(t *testing.T) {
+    var out bytes.Buffer
+    in := New(WithOutput(&out))
+    in.Process(`(write "a b") (newline) (display "a b") (newline) (write '(1 "x"))`)
+    AssertThat(t, out.String(), Equals("\"a b\"\na b\n(1 \"x\")"))
+}
+
+func TestPPrintsReadably(t *testing.T) {
+    var out bytes.Buffer
+    in := New(WithOutput(&out))
+    in.Process(`(p 'a 1 "s" '(b c))`)
+    AssertThat(t, out.String(), Equals("a 1 \"s\" (b c)\n"))
+}
+
+func TestErrorMessagesPrintValuesAsSource(t *testing.T) {
+    AssertThat(t, processError(t, "(let ((a 1) b) a)").Message, Equals("LET expects each binding to be a (name value) pair; found b"))
+    AssertThat(t, processError(t, "(lambda ((a 1 2)) a)").Message, Equals("LAMBDA parameters must be symbols; found (a 1 2)"))
+    AssertThat(t, processError(t, "(+ 1 (cons 2 0))").Message, Equals("+ expects numbers; found (2 . 0)"))
+    AssertThat(t, processError(t, "(rem (lambda (x) x))").Message, Equals("rem requires exactly 2 parameters; you have 1 - (#<lambda (x)>)"))
+    AssertThat(t, processError(t, "(#t)").Message, Equals("A list should start with a function - found #t in (#t)"))
+    AssertThat(t, processError(t, "(5 'a \"b\")").Message, Equals("A list should start with a function - found 5 in (5 (quote a) \"b\")"))
+}
+
+func TestDeeplyNestedListsPrintWithoutOverflowing(t *testing.T) {
+    var deep Value = List{}
+    for i := 0; i < 2*maxNesting; i++ {
+        deep = List{deep}
+    }
+    printed := Write(deep)
+    AssertThat(t, printed[:3], Equals("(((" ))
+    AssertThat(t, printed[maxNesting:maxNesting+3], Equals("..."))
+}
@@ -0,0 +1,34 @@
+package glisp
+
+import (
+    "bufio"
+    "io"
+)
+
+// Reader reads glisp source one top-level form at a time, so a big script
+// or a network stream can be evaluated as it arrives instead of all at once.
+type Reader struct {
+    tz *tokenizer
+}
+
+// NewReader reads from r. fname is used in the positions of what it reads,
+// and may be empty.
+func NewReader(r io.Reader, fname string) *Reader {
+    rs, ok := r.(io.RuneScanner)
+    if !ok {
+        rs = bufio.NewReader(r)
+    }
+    return &Reader{newTokenizer(rs, fname)}
+}
+
+// Read returns the next top-level form, or io.EOF when there are no more.
+// Input that ends partway through a form is an INCOMPLETE_ERROR.
+func (r *Reader) Read() (Value, error) {
+    return r.tz.read()
+}
+
+// positioned wraps the form Read just returned in a List that remembers
+// where it was read, ready for ProcessTokens.
+func (r *Reader) positioned(form Value) List {
+    return recordPositions(List{form}, []Pos{r.tz.last})
+}
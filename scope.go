@@ -1,13 +1,46 @@
 package glisp
 
+// Scope is one level of bindings. readOnly marks the builtins, which set!
+// can't change: a def shadows them in the global scope instead. Every scope
+// of an Interpreter shares its depth.
 type Scope struct {
     prev *Scope
     table map[string]interface{}
-    isMacroScope bool
+    readOnly bool
+    depth *evalDepth
+}
+
+// evalDepth counts how deeply GetValue calls are nested, so that runaway
+// recursion becomes an error before it can overflow the Go stack, which
+// nothing can recover from.
+type evalDepth struct {
+    current int
+    max int
+}
+
+// nest counts one more level of nesting in form, or fails if that would go
+// past the limit. Each nest that succeeds has to be undone by unnest. A
+// scope made outside an Interpreter has no limit.
+func (scope *Scope) nest(form interface{}) error {
+    if scope == nil || scope.depth == nil {
+        return nil
+    }
+    d := scope.depth
+    if d.current >= d.max {
+        return NewError(EVAL_ERROR, form, "Evaluation nested more than %v deep; is there a runaway recursion?", d.max)
+    }
+    d.current++
+    return nil
+}
+
+func (scope *Scope) unnest() {
+    if scope != nil && scope.depth != nil {
+        scope.depth.current--
+    }
 }
 
 func (scope *Scope) lookup(name Symbol) (interface{}, bool) {
-    if val, ok := scope.table[name.Str()]; ok {
+    if val, ok := scope.table[name.key()]; ok {
         return val, ok
     }
     if scope.prev != nil {
@@ -21,6 +54,16 @@ func (scope *Scope) add(name string, defn interface{}) {
     return
 }
 
-func (scope *Scope) createNonEvaluatingScope() *Scope {
-    return &Scope{scope, map[string]interface{}{}, true}
+// find returns the nearest scope in which name is bound, or nil.
+func (scope *Scope) find(name string) *Scope {
+    for s := scope; s != nil; s = s.prev {
+        if _, ok := s.table[name]; ok {
+            return s
+        }
+    }
+    return nil
+}
+
+func (scope *Scope) child() *Scope {
+    return &Scope{scope, map[string]interface{}{}, false, scope.depth}
 }
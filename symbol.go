@@ -1,26 +1,57 @@
 package glisp
 
-import ( "fmt" )
+import (
+    "fmt"
+)
 
-
-type Symbol struct { name string }
+// Symbol is a name. Two symbols with the same name are the same symbol,
+// wherever they were read: where each one was is kept by the list it was
+// read in. The exception is a gensym, which has a non-zero id: it is
+// uninterned, so it is different from every other symbol, including one
+// typed in with the same name.
+type Symbol struct {
+    name string
+    id uint64
+}
 
 func (sym Symbol) Str() string {
     return sym.name
 }
 
-func (sym Symbol) Eval(scope *Scope) interface{} {
-    if scope.isMacroScope {
-        return sym
-    } else if resolved, ok := scope.lookup(sym); ok {
-        return resolved
-    } else {
-        panic(fmt.Sprintf("Cannot resolve symbol %v in lookup %#v\n", sym.name, scope))
+// String makes a symbol print as its name, wherever it ends up in a %v.
+func (sym Symbol) String() string {
+    return sym.name
+}
+
+// Eval looks sym up, except that a keyword like :name stands for itself.
+func (sym Symbol) Eval(scope *Scope) (interface{}, error) {
+    if sym.isKeyword() {
+        return sym, nil
+    }
+    if resolved, ok := scope.lookup(sym); ok {
+        if resolved == unassigned {
+            return nil, NewError(EVAL_ERROR, sym, "%v is used before letrec has given it a value", sym.name)
+        }
+        return resolved, nil
     }
+    return nil, NewError(UNBOUND_ERROR, sym, "Cannot resolve symbol %v", sym.name)
+}
+
+func (sym Symbol) isKeyword() bool {
+    return len(sym.name) > 1 && sym.name[0] == ':'
 }
 
 func symbol(s string) Symbol {
-    return Symbol{s}
+    return Symbol{s, 0}
+}
+
+// key is what sym is bound under in a Scope. A gensym's has a character in
+// it that no symbol the reader makes can, so it can't clash with one.
+func (sym Symbol) key() string {
+    if sym.id == 0 {
+        return sym.name
+    }
+    return fmt.Sprintf("%v\x00%v", sym.name, sym.id)
 }
 
 func (sym Symbol) Append(c rune) Symbol {
@@ -31,7 +62,3 @@ func (sym Symbol) Append(c rune) Symbol {
 func (sym Symbol) IsEmpty() bool {
     return sym.name == ""
 }
-
-func (sym Symbol) Type() TokenType {
-    return SYMBOL
-}
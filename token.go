@@ -2,120 +2,109 @@ package glisp
 
 import (
     "strings"
-    "strconv"
     "fmt"
-    "reflect"
 )
 
-type TokenType int8
-const (
-    STRING TokenType = iota
-    NUM
-    SYMBOL
-)
-
-type Token interface {
-    Str() string
-    Type() TokenType
-}
-
-func token(s string) Token {
-    if strings.HasPrefix(s, "\"") {
-        return StringToken{s[1:len(s)-1]}
-    } else if _, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
-        return NumberToken{s}
-    }
-    return Symbol{s}
-}
-
-type StringToken struct {
-    value string
-}
+// Value is anything a glisp program can hold. The reader produces the same
+// values that evaluation does, so quoted and computed data compare alike:
+//
+//    nil, #f, #t    nil, false, true
+//    numbers        int64, *big.Int, *big.Rat or float64 - see numeric.go
+//    strings        string
+//    symbols        Symbol
+//    lists          List, or *Pair for (a . b) and improper lists
+//    procedures     Function, NonEvaluatingFunction, *Closure or *macro
+type Value = interface{}
 
-func (s StringToken) Str() string {
-    return s.value
+// Pos is a location in glisp source. Lines and columns count from 1, so the
+// zero Pos means the location isn't known.
+type Pos struct {
+    File string
+    Line int
+    Col int
 }
 
-func (s StringToken) Value() string {
-    return s.value
+func (p Pos) IsValid() bool {
+    return p.Line > 0
 }
 
-func (s StringToken) Eval(scope *Scope) interface{} {
-    return s.value
-}
-
-func (s StringToken) Equals(other interface{}) (bool, string) {
-    switch o := other.(type) {
-    case string:
-        return o == s.value, fmt.Sprintf("Expected %v, actual %v\n", s.value, o)
-    case StringToken:
-        return o.value == s.value, fmt.Sprintf("Expected %v, actual %v\n", s.value, o.value)
-    case reflect.Value:
-        if o.CanInterface() {
-            return s.Equals(o.Interface())
-        }
-        return false, fmt.Sprintf("Cannot coerce Value %v to string (%v)\n", o, s.Value())
-    default:
-        return false, fmt.Sprintf("Expected string (%v), found %T %v\n", s.value, o, o)
+func (p Pos) String() string {
+    if !p.IsValid() {
+        return p.File
     }
-}
-
-func (s StringToken) Type() TokenType {
-    return STRING
-}
-
-type NumberToken struct {
-    value string
-}
-
-func (n NumberToken) Str() string {
-    return n.value
-}
-
-func (n NumberToken) Value() int64 {
-    num, err := strconv.ParseInt(strings.TrimSpace(n.value), 10, 64)
-    if err == nil {
-        return num
+    if p.File == "" {
+        return fmt.Sprintf("%v:%v", p.Line, p.Col)
     }
-    panic(fmt.Sprintf("Could not parse %v as a number!!", n.value))
+    return fmt.Sprintf("%v:%v:%v", p.File, p.Line, p.Col)
 }
 
-func (n NumberToken) Eval(scope *Scope) interface{} {
-    return n.Value()
+// PositionOf reports where a form came from. A list the reader made is
+// located by its first element; any other list by the first positioned form
+// inside it. Atoms, symbols included, have no position of their own: ask the
+// list they were read in with PositionIn.
+func PositionOf(form interface{}) Pos {
+    budget := positionSearch
+    return positionOf(form, &budget)
 }
 
-func (n NumberToken) Type() TokenType {
-    return NUM
-}
+// positionSearch is how many forms PositionOf looks at before it gives up.
+// A form that was built rather than read might be huge, or even circular,
+// and has no position of its own anyway.
+const positionSearch = 100
 
-func (n NumberToken) Equals(other interface{}) (bool, string) {
-    switch o := other.(type) {
-    case NumberToken:
-        return o.Value() == n.Value(), fmt.Sprintf("Expected %v, found %v\n", n.Value(), o.Value())
-    case int64:
-        return o == n.Value(), fmt.Sprintf("Expected %v, found %v\n", n.Value(), o)
-    case reflect.Value:
-        if o.CanInterface() {
-            return n.Equals(o.Interface())
+func positionOf(form interface{}, budget *int) Pos {
+    if *budget <= 0 {
+        return Pos{}
+    }
+    *budget--
+    switch f := form.(type) {
+    case List:
+        if len(f) > 0 {
+            if pos, ok := recorded(f, 0); ok {
+                return pos
+            }
         }
-        return false, fmt.Sprintf("Cannot coerce Value %v to int (%v)\n", o, n.Value())
-    default:
-        return false, fmt.Sprintf("Expected number (%v), found %T %v\n", n.Value(), o, o)
+        for _, element := range f {
+            if pos := positionOf(element, budget); pos.IsValid() || *budget <= 0 {
+                return pos
+            }
+        }
+    case *Pair:
+        if pos := positionOf(f.car, budget); pos.IsValid() {
+            return pos
+        }
+        return positionOf(f.cdr, budget)
     }
+    return Pos{}
+}
+
+// token turns the text of an atom into the same value evaluation would
+// produce.
+func token(s string) Value {
+    switch s {
+    case "#t", "true":
+        return true
+    case "#f", "false":
+        return false
+    case "nil":
+        return nil
+    }
+    if strings.HasPrefix(s, "\"") {
+        return s[1:len(s)-1]
+    } else if n, ok := parseNumber(s); ok {
+        return n
+    }
+    return symbol(s)
 }
 
-func num(n int64) NumberToken {
-    return NumberToken{fmt.Sprintf("%v", n)}
-}
-
-func str(s string) StringToken {
-    return StringToken{s}
-}
-
-func str_token(s string) StringToken {
-    return StringToken{s}
-}
-
-func num_token(s string) NumberToken {
-    return NumberToken{s}
+// truthy is the one rule for what counts as true: everything except false
+// and nil, so 0, "" and () are all true.
+func truthy(value Value) bool {
+    switch v := value.(type) {
+    case nil:
+        return false
+    case bool:
+        return v
+    }
+    return true
 }
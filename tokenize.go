@@ -2,58 +2,427 @@ package glisp
 
 import (
     "unicode"
+    "bufio"
     "bytes"
-    "io/ioutil"
+    "io"
+    "os"
+    "strconv"
+    "strings"
 )
 
-func TokenizeString(input string) List {
-    b := bytes.NewBufferString(input)
-    return Tokenize(b)
+func TokenizeString(input string) (List, error) {
+    return newTokenizer(strings.NewReader(input), "").tokenize()
 }
 
-func TokenizeFile(fname string) List {
-    fileBytes,err := ioutil.ReadFile(fname)
+func TokenizeFile(fname string) (List, error) {
+    f, err := os.Open(fname)
     if err != nil {
-        return nil
+        return nil, err
     }
-    b := bytes.NewBuffer(fileBytes)
-    return Tokenize(b)
+    defer f.Close()
+    return newTokenizer(bufio.NewReader(f), fname).tokenize()
 }
 
-func Tokenize(bs *bytes.Buffer) List {
-    if bs.Len() == 0 {
-        return nil
+func Tokenize(bs *bytes.Buffer) (List, error) {
+    return newTokenizer(bs, "").tokenize()
+}
+
+// quoteForms are the reader shorthands: 'x reads as (quote x), and so on.
+var quoteForms = map[string]string {
+    "'" : "quote",
+    "`" : "quasiquote",
+    "," : "unquote",
+    ",@": "unquote-splicing",
+}
+
+// maxNesting is how deeply lists and quotes can nest in source. Each level
+// takes a level of Go recursion to read, and a Go stack overflow can't be
+// recovered from, so anything deeper is a READ_ERROR instead.
+const maxNesting = 10000
+
+// tokenizer remembers where in the source it is, so that every form can be
+// located by the file, line and column it started at. last is where the
+// form nextForm most recently returned started. depth is how many forms
+// nextForm is in the middle of reading. ioErr holds any failure of the
+// underlying reader other than io.EOF.
+type tokenizer struct {
+    bs io.RuneScanner
+    pos Pos
+    last Pos
+    depth int
+    ioErr error
+}
+
+func newTokenizer(bs io.RuneScanner, fname string) *tokenizer {
+    return &tokenizer{bs, Pos{fname, 1, 1}, Pos{}, 0, nil}
+}
+
+func (tz *tokenizer) next() (rune, error) {
+    c, size, err := tz.bs.ReadRune()
+    if err != nil {
+        return 0, err
+    }
+    if c == unicode.ReplacementChar && size == 1 {
+        return 0, tz.errorf(tz.pos, "Invalid UTF-8 in source")
+    }
+    if c == '\n' {
+        tz.pos.Line++
+        tz.pos.Col = 1
+    } else {
+        tz.pos.Col++
+    }
+    return c, nil
+}
+
+func (tz *tokenizer) peek() rune {
+    c, _, err := tz.bs.ReadRune()
+    if err != nil {
+        if err != io.EOF {
+            tz.ioErr = err
+        }
+        return 0
+    }
+    tz.bs.UnreadRune()
+    return c
+}
+
+func (tz *tokenizer) atEnd() bool {
+    if tz.ioErr != nil {
+        return true
+    }
+    _, _, err := tz.bs.ReadRune()
+    if err != nil {
+        if err != io.EOF {
+            tz.ioErr = err
+        }
+        return true
+    }
+    tz.bs.UnreadRune()
+    return false
+}
+
+func (tz *tokenizer) errorf(pos Pos, format string, args ...interface{}) error {
+    err := NewError(READ_ERROR, nil, format, args...)
+    err.Pos = pos
+    return err
+}
+
+// incompletef is for input that stops in the middle of a form: more input
+// might fix it.
+func (tz *tokenizer) incompletef(pos Pos, format string, args ...interface{}) error {
+    err := NewError(INCOMPLETE_ERROR, nil, format, args...)
+    err.Pos = pos
+    return err
+}
+
+// missingForm reports that the form expected after a prefix like ' isn't
+// there, which is only incomplete if the input has run out.
+func (tz *tokenizer) missingForm(pos Pos, message string) error {
+    if tz.atEnd() {
+        return tz.incompletef(pos, "%v", message)
+    }
+    return tz.errorf(pos, "%v", message)
+}
+
+// Besides letters and digits, symbols can use any of these, and any other
+// Unicode symbol character.
+const symbolPunctuation = "!$%&*/:<=>?^_~+-.@#"
+
+func isDelimiter(c rune) bool {
+    return unicode.IsSpace(c) || strings.ContainsRune("()\"';`,", c)
+}
+
+func isAtomChar(c rune) bool {
+    if isDelimiter(c) || c == '|' {
+        return false
+    }
+    return unicode.IsLetter(c) || unicode.IsNumber(c) || unicode.IsMark(c) ||
+        unicode.IsSymbol(c) || strings.ContainsRune(symbolPunctuation, c)
+}
+
+// tokenize reads every form up to the end of the input.
+func (tz *tokenizer) tokenize() (List, error) {
+    if tz.atEnd() {
+        return nil, tz.ioErr
     }
     r := List{}
+    elems := []Pos{}
+    for {
+        form, err := tz.read()
+        if err == io.EOF {
+            return recordPositions(r, elems), nil
+        } else if err != nil {
+            return nil, err
+        }
+        r = append(r, form)
+        elems = append(elems, tz.last)
+    }
+}
 
-    inQuote := false;
+// read reads one top-level form, returning io.EOF once the input runs out.
+func (tz *tokenizer) read() (Value, error) {
+    form, ok, err := tz.nextForm()
+    if tz.ioErr != nil {
+        return nil, tz.ioErr
+    } else if err != nil {
+        return nil, err
+    } else if ok {
+        return form, nil
+    } else if tz.atEnd() {
+        return nil, io.EOF
+    }
+    pos := tz.pos
+    tz.next()
+    return nil, tz.errorf(pos, "Unexpected ) with no ( to close")
+}
 
-    acc := ""
-    for ; bs.Len() > 0 ; {
-        c := rune(bs.Next(1)[0])
-        
-        if unicode.IsLetter(c) || unicode.IsNumber(c) || c == '-' || c == '_' || c == '?' {
-            acc += string(c)
-        } else if c == '(' {
-            nested := Tokenize(bs)
-            r = append(r, nested)
-        } else if c == ')' {
+// list reads the rest of a list whose ( was at open. A dotted list may
+// read as a Pair rather than a List.
+func (tz *tokenizer) list(open Pos) (interface{}, error) {
+    r := List{}
+    elems := []Pos{}
+    for {
+        form, ok, err := tz.nextForm()
+        if err != nil {
+            return nil, err
+        }
+        if !ok {
             break
-        } else if c== '"' {
-            inQuote = !inQuote
-            acc += string(c)
-        } else if inQuote {
+        }
+        if dot, ok := form.(Symbol); ok && dot.name == "." {
+            return tz.dotted(open, tz.last, r, elems)
+        }
+        r = append(r, form)
+        elems = append(elems, tz.last)
+    }
+    if err := tz.close(open); err != nil {
+        return nil, err
+    }
+    return recordPositions(r, elems), nil
+}
+
+// dotted reads the rest of a list like (a b . c), after the dot. If the
+// tail turns out to be a list, as in (a . (b c)), the result is a List.
+func (tz *tokenizer) dotted(open Pos, dot Pos, r List, elems []Pos) (interface{}, error) {
+    if len(r) == 0 {
+        return nil, tz.errorf(dot, "Expected a form before . in a list")
+    }
+    tail, ok, err := tz.nextForm()
+    if err != nil {
+        return nil, err
+    } else if !ok {
+        return nil, orError(tz.close(open), tz.errorf(dot, "Expected a form after . in a list"))
+    }
+    if _, ok, err := tz.nextForm(); err != nil {
+        return nil, err
+    } else if ok {
+        return nil, tz.errorf(dot, "Expected ) after the form that follows .")
+    }
+    if err := tz.close(open); err != nil {
+        return nil, err
+    }
+    if list, ok := tail.(List); ok {
+        for i := range list {
+            elems = append(elems, PositionIn(list, i))
+        }
+        return recordPositions(append(r, list...), elems), nil
+    }
+    for i := len(r) - 1; i >= 0; i-- {
+        tail = consOnto(r[i], tail)
+    }
+    return tail, nil
+}
+
+// close reads the ) of the list whose ( was at open.
+func (tz *tokenizer) close(open Pos) error {
+    if tz.atEnd() {
+        return tz.incompletef(open, "Unclosed ( - expected a )")
+    }
+    tz.next()
+    return nil
+}
+
+// form reads the next form. It reports false if all it found was
+// whitespace.
+func (tz *tokenizer) form() (interface{}, bool, error) {
+    start := tz.pos
+    c, err := tz.next()
+    if err != nil {
+        return nil, false, err
+    }
+    switch {
+    case unicode.IsSpace(c):
+        return nil, false, nil
+    case c == ';':
+        for !tz.atEnd() && tz.peek() != '\n' {
+            tz.next()
+        }
+        return nil, false, nil
+    case c == '#' && tz.peek() == '|':
+        tz.next()
+        return nil, false, tz.blockComment(start)
+    case c == '#' && tz.peek() == ';':
+        tz.next()
+        if _, ok, err := tz.nextForm(); err != nil || !ok {
+            return nil, false, orError(err, tz.missingForm(start, "#; must be followed by the form to comment out"))
+        }
+        return nil, false, nil
+    case c == '(':
+        list, err := tz.list(start)
+        return list, err == nil, err
+    case c == '\'' || c == '`' || c == ',':
+        prefix := string(c)
+        if c == ',' && tz.peek() == '@' {
+            tz.next()
+            prefix = ",@"
+        }
+        return tz.quoted(start, symbol(quoteForms[prefix]))
+    case c == '"':
+        value, err := tz.str(start)
+        return value, err == nil, err
+    case isAtomChar(c):
+        acc := string(c)
+        for !tz.atEnd() && isAtomChar(tz.peek()) {
+            if c, err = tz.next(); err != nil {
+                return nil, false, err
+            }
             acc += string(c)
-        } else {
-            if acc != "" {
-                r = append(r, token(acc))
+        }
+        return token(acc), true, nil
+    }
+    return nil, false, tz.errorf(start, "Unexpected character %q", c)
+}
+
+// str reads the rest of a string literal, after its opening quote.
+func (tz *tokenizer) str(start Pos) (string, error) {
+    var value strings.Builder
+    for {
+        if tz.atEnd() {
+            return "", tz.incompletef(start, "Unterminated string")
+        }
+        at := tz.pos
+        c, err := tz.next()
+        if err != nil {
+            return "", err
+        }
+        switch c {
+        case '"':
+            return value.String(), nil
+        case '\\':
+            escaped, err := tz.escape(start, at)
+            if err != nil {
+                return "", err
             }
-            acc = ""
+            value.WriteRune(escaped)
+        default:
+            value.WriteRune(c)
+        }
+    }
+}
+
+var escapes = map[rune]rune {
+    '"' : '"',
+    '\\': '\\',
+    'n' : '\n',
+    't' : '\t',
+    'r' : '\r',
+}
+
+// escape reads what follows a backslash in a string: one of the escapes
+// above, or \u{...} with the hex code of any Unicode character.
+// at is where the backslash was.
+func (tz *tokenizer) escape(start Pos, at Pos) (rune, error) {
+    if tz.atEnd() {
+        return 0, tz.incompletef(start, "Unterminated string")
+    }
+    c, err := tz.next()
+    if err != nil {
+        return 0, err
+    }
+    if escaped, ok := escapes[c]; ok {
+        return escaped, nil
+    }
+    if c != 'u' || tz.peek() != '{' {
+        return 0, tz.errorf(at, "Unknown escape sequence \\%c in string", c)
+    }
+    tz.next()
+    hex := ""
+    for !tz.atEnd() && tz.peek() != '}' && tz.peek() != '"' {
+        c, err := tz.next()
+        if err != nil {
+            return 0, err
         }
+        hex += string(c)
+    }
+    if tz.atEnd() {
+        return 0, tz.incompletef(start, "Unterminated string")
+    } else if tz.peek() != '}' {
+        return 0, tz.errorf(at, "Unterminated \\u{...} escape in string")
+    }
+    tz.next()
+    code, err := strconv.ParseUint(hex, 16, 32)
+    if err != nil || code > unicode.MaxRune || (code >= 0xD800 && code <= 0xDFFF) {
+        return 0, tz.errorf(at, "Invalid character code \\u{%v} in string", hex)
+    }
+    return rune(code), nil
+}
 
+// blockComment skips to the |# that closes the #| before start. Block
+// comments nest.
+func (tz *tokenizer) blockComment(start Pos) error {
+    depth := 1
+    for depth > 0 {
+        if tz.atEnd() {
+            return tz.incompletef(start, "Unterminated #| comment")
+        }
+        c, err := tz.next()
+        if err != nil {
+            return err
+        }
+        if c == '|' && tz.peek() == '#' {
+            tz.next()
+            depth--
+        } else if c == '#' && tz.peek() == '|' {
+            tz.next()
+            depth++
+        }
     }
-    if acc != "" {
-        r = append(r, token(acc))
+    return nil
+}
+
+func orError(err error, otherwise error) error {
+    if err != nil {
+        return err
+    }
+    return otherwise
+}
+
+// nextForm reads forms until it gets one that isn't whitespace or a
+// comment, stopping at a ')' or the end of the input. It leaves where the
+// form started in tz.last. Lists, quotes and #; all read their insides with
+// nextForm, so it is what keeps nesting within maxNesting.
+func (tz *tokenizer) nextForm() (interface{}, bool, error) {
+    if tz.depth >= maxNesting {
+        return nil, false, tz.errorf(tz.pos, "Forms nested more than %v deep", maxNesting)
+    }
+    tz.depth++
+    defer func() { tz.depth-- }()
+    for !tz.atEnd() && tz.peek() != ')' {
+        start := tz.pos
+        form, ok, err := tz.form()
+        if err != nil || ok {
+            tz.last = start
+            return form, ok, err
+        }
+    }
+    return nil, false, nil
+}
+
+// quoted wraps the form after the quote character at start.
+func (tz *tokenizer) quoted(start Pos, quote Symbol) (interface{}, bool, error) {
+    form, ok, err := tz.nextForm()
+    if err != nil || !ok {
+        return nil, false, orError(err, tz.missingForm(start, "Expected a form to " + quote.Str()))
     }
-    return r
+    return recordPositions(List{quote, form}, []Pos{start, tz.last}), true, nil
 }
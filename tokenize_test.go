@@ -1,47 +1,67 @@
 package glisp
 
 import (
+    "io"
+    "strings"
     "testing"
+    "testing/iotest"
 
     // Use github version as soon as changes are uploaded.
     . "github.com/tychofreeman/go-matchers"
     //. "matchers"
 )
 
+func tokenize(t *testing.T, input string) List {
+    tokens, err := TokenizeString(input)
+    if err != nil {
+        t.Fatalf("TokenizeString(%q) failed: %v", input, err)
+    }
+    return tokens
+}
+
+func tokenizeError(t *testing.T, input string) *Error {
+    _, err := TokenizeString(input)
+    e, ok := err.(*Error)
+    if !ok {
+        t.Fatalf("TokenizeString(%q) should have failed with *Error; got %T %v", input, err, err)
+    }
+    return e
+}
+
 func TestEmptyStringYieldsNilList(t *testing.T) {
-    AssertThat(t, TokenizeString(""), IsEmpty);
+    AssertThat(t, tokenize(t, ""), IsEmpty);
 }
 
 func TestBareParensYieldsEmptyList(t *testing.T) {
-    AssertThat(t, TokenizeString("()"), HasExactly(HasExactly()));
+    AssertThat(t, tokenize(t, "()"), HasExactly(HasExactly()));
 }
 
 func TestIgnoresLeadingAndTrailingSpaces(t *testing.T) {
-    AssertThat(t, TokenizeString("  () "), HasExactly(HasExactly()))
+    AssertThat(t, tokenize(t, "  () "), HasExactly(HasExactly()))
 }
 
 func TestSymbolNamesAddedToList(t *testing.T) {
-    AssertThat(t, TokenizeString("(a)"), HasExactly(HasExactly(symbol("a"))))
+    AssertThat(t, tokenize(t, "(a)"), HasExactly(HasExactly(symbol("a"))))
 }
 
 func TestAddsMultipleSymbolNamesToListInOrder(t *testing.T) {
-    AssertThat(t, TokenizeString("(a b c)"), HasExactly(HasExactly(symbol("a"), symbol("b"), symbol("c"))))
+    AssertThat(t, tokenize(t, "(a b c)"), HasExactly(HasExactly(symbol("a"), symbol("b"), symbol("c"))))
 }
 
 func TestSymbolNamesCanHaveMultipleLetters(t *testing.T) {
-    AssertThat(t, TokenizeString("(abc def ghi)"), HasExactly(HasExactly(symbol("abc"), symbol("def"), symbol("ghi"))))
+    AssertThat(t, tokenize(t, "(abc def ghi)"), HasExactly(HasExactly(symbol("abc"), symbol("def"), symbol("ghi"))))
 }
 
 func TestParensCreatesANestedList(t *testing.T) {
-    AssertThat(t, TokenizeString("(a (b))"), HasExactly(HasExactly(symbol("a"), HasExactly(symbol("b")))))
+    AssertThat(t, tokenize(t, "(a (b))"), HasExactly(HasExactly(symbol("a"), HasExactly(symbol("b")))))
 }
 
 func TestNestedListsCanComeInTheMiddleToo(t *testing.T) {
-    AssertThat(t, TokenizeString("(a (b) c)"), HasExactly(HasExactly(symbol("a"), HasExactly(symbol("b")), symbol("c"))))
+    AssertThat(t, tokenize(t, "(a (b) c)"), HasExactly(HasExactly(symbol("a"), HasExactly(symbol("b")), symbol("c"))))
 }
 
 func TestDeeplyNestedListsWorkToo(t *testing.T) {
-    AssertThat(t, TokenizeString("(a (b (c (d (e (f (g (h (i (j (k (l))))))))))) m (n (o (p (q (r))))) s)"), 
+    AssertThat(t, tokenize(t, "(a (b (c (d (e (f (g (h (i (j (k (l))))))))))) m (n (o (p (q (r))))) s)"), 
         HasExactly(
             HasExactly(symbol("a"),
                         HasExactly(symbol("b"), HasExactly(symbol("c"), HasExactly(symbol("d"), HasExactly(symbol("e"), HasExactly(symbol("f"), HasExactly(symbol("g"), HasExactly(symbol("h"), HasExactly(symbol("i"), HasExactly(symbol("j"), HasExactly(symbol("k"), HasExactly(symbol("l"), ))))))))))),
@@ -51,25 +71,278 @@ func TestDeeplyNestedListsWorkToo(t *testing.T) {
 }
 
 func TestMultipleFirstLevelExprsPossible(t *testing.T) {
-    AssertThat(t, TokenizeString("(a) (b) (c)"), HasExactly(HasExactly(symbol("a")), HasExactly(symbol("b")), HasExactly(symbol("c"))))
+    AssertThat(t, tokenize(t, "(a) (b) (c)"), HasExactly(HasExactly(symbol("a")), HasExactly(symbol("b")), HasExactly(symbol("c"))))
 }
 
 func TestHandlesNumbersToo(t *testing.T) {
-    AssertThat(t, TokenizeString("1"), HasExactly(token("1")))
+    AssertThat(t, tokenize(t, "1"), HasExactly(int64(1)))
 }
 
 func TestHandlesStringLiterals(t *testing.T) {
-    AssertThat(t, TokenizeString("\"abc\""), HasExactly(token("\"abc\"")))
+    AssertThat(t, tokenize(t, "\"abc\""), HasExactly("abc"))
 }
 
 func TestHandlesStringsWithSpaces(t *testing.T) {
-    AssertThat(t, TokenizeString("\"abc def\" \"ghi jkl\""), HasExactly(token("\"abc def\""), token("\"ghi jkl\"")))
+    AssertThat(t, tokenize(t, "\"abc def\" \"ghi jkl\""), HasExactly("abc def", "ghi jkl"))
 }
 
 func TestHandlesNegativeNumbers(t *testing.T) {
-    AssertThat(t, TokenizeString("-1"), HasExactly(token("-1")))
+    AssertThat(t, tokenize(t, "-1"), HasExactly(int64(-1)))
 }
 
 func TestHandlesUnderscoresInNames(t *testing.T) {
-    AssertThat(t, TokenizeString("\"a_b\""), HasExactly(token("\"a_b\"")))
+    AssertThat(t, tokenize(t, "\"a_b\""), HasExactly("a_b"))
+}
+
+func TestTokensRecordLineAndColumn(t *testing.T) {
+    tokens := tokenize(t, "(a\n  (bc d 12))")
+    inner := tokens[0].(List)
+    AssertThat(t, PositionIn(inner, 0), Equals(Pos{"", 1, 2}))
+    nested := inner[1].(List)
+    AssertThat(t, PositionIn(nested, 0), Equals(Pos{"", 2, 4}))
+    AssertThat(t, PositionIn(nested, 1), Equals(Pos{"", 2, 7}))
+    AssertThat(t, nested[2], Equals(int64(12)))
+}
+
+func TestSymbolsReadInDifferentPlacesAreTheSame(t *testing.T) {
+    tokens := tokenize(t, "a\n  (a)")
+    first, second := tokens[0], tokens[1].(List)[0]
+    AssertThat(t, first == second, IsTrue)
+    AssertThat(t, map[Value]int{first: 1}[second], Equals(1))
+}
+
+func TestListsAreLocatedByTheirFirstForm(t *testing.T) {
+    tokens := tokenize(t, "\n (foo bar)")
+    AssertThat(t, PositionOf(tokens[0]), Equals(Pos{"", 2, 3}))
+}
+
+func TestListsRecordWhereTheirElementsWereRead(t *testing.T) {
+    tokens := tokenize(t, "1 (2\n  \"three\" ())")
+    AssertThat(t, PositionIn(tokens, 0), Equals(Pos{"", 1, 1}))
+    list := tokens[1].(List)
+    AssertThat(t, PositionIn(list, 1), Equals(Pos{"", 2, 3}))
+    AssertThat(t, PositionOf(list.Rest()), Equals(Pos{"", 2, 3}))
+    AssertThat(t, PositionIn(list, 2), Equals(Pos{"", 2, 11}))
+}
+
+func TestAppendingToAReadListKeepsItsPositions(t *testing.T) {
+    tokens := tokenize(t, "a\n b")
+    more := append(tokens, symbol("c"), symbol("d"))
+    AssertThat(t, PositionIn(tokens, 1), Equals(Pos{"", 2, 2}))
+    AssertThat(t, PositionIn(more, 2).IsValid(), IsFalse)
+}
+
+func TestQuoteCharacterExpandsToQuoteForm(t *testing.T) {
+    AssertThat(t, tokenize(t, "'x"), HasExactly(HasExactly(symbol("quote"), symbol("x"))))
+    AssertThat(t, tokenize(t, "'(a b)"), HasExactly(HasExactly(symbol("quote"), HasExactly(symbol("a"), symbol("b")))))
+}
+
+func TestQuasiquoteCharacters(t *testing.T) {
+    AssertThat(t, tokenize(t, "`(a ,b ,@c)"), HasExactly(HasExactly(symbol("quasiquote"), HasExactly(
+        symbol("a"),
+        HasExactly(symbol("unquote"), symbol("b")),
+        HasExactly(symbol("unquote-splicing"), symbol("c"))))))
+}
+
+func TestQuotesNest(t *testing.T) {
+    AssertThat(t, tokenize(t, "''a"), HasExactly(HasExactly(symbol("quote"), HasExactly(symbol("quote"), symbol("a")))))
+}
+
+func TestQuoteFormsArePositionedAtTheQuote(t *testing.T) {
+    AssertThat(t, PositionOf(tokenize(t, "  'a")[0]), Equals(Pos{"", 1, 3}))
+}
+
+func TestDecodesMultiByteCharacters(t *testing.T) {
+    AssertThat(t, tokenize(t, "(λ café \"日本\")"), HasExactly(HasExactly(symbol("λ"), symbol("café"), "日本")))
+}
+
+func TestColumnsCountCharactersNotBytes(t *testing.T) {
+    AssertThat(t, PositionIn(tokenize(t, "(é b)")[0].(List), 1), Equals(Pos{"", 1, 4}))
+}
+
+func TestSymbolsCanUseLispPunctuation(t *testing.T) {
+    AssertThat(t, tokenize(t, "(+ - * / < > = <= ! set! a.b :key x->y $%&^~@ ∑)"), HasExactly(HasExactly(
+        symbol("+"), symbol("-"), symbol("*"), symbol("/"), symbol("<"), symbol(">"), symbol("="), symbol("<="),
+        symbol("!"), symbol("set!"), symbol("a.b"), symbol(":key"), symbol("x->y"), symbol("$%&^~@"), symbol("∑"))))
+}
+
+func TestUnexpectedCharactersAreErrors(t *testing.T) {
+    err := tokenizeError(t, "(a\n  [b])")
+    AssertThat(t, err.Kind, Equals(READ_ERROR))
+    AssertThat(t, err.Pos, Equals(Pos{"", 2, 3}))
+}
+
+func TestInvalidUTF8IsAnError(t *testing.T) {
+    AssertThat(t, tokenizeError(t, "(a \xff)").Kind, Equals(READ_ERROR))
+}
+
+func TestStringEscapes(t *testing.T) {
+    AssertThat(t, tokenize(t, `"a\"b" "c\\d" "e\nf\tg" "\u{3bb}\u{1F600}"`), HasExactly("a\"b", "c\\d", "e\nf\tg", "λ😀"))
+}
+
+func TestStringsKeepDelimiters(t *testing.T) {
+    AssertThat(t, tokenize(t, `("a(b" "c;d)" "'e")`), HasExactly(HasExactly("a(b", "c;d)", "'e")))
+}
+
+func TestUnterminatedStringsReportWhereTheyStart(t *testing.T) {
+    err := tokenizeError(t, "(a\n \"bc)")
+    AssertThat(t, err.Kind, Equals(INCOMPLETE_ERROR))
+    AssertThat(t, err.Pos, Equals(Pos{"", 2, 2}))
+    AssertThat(t, tokenizeError(t, `"abc\`).Pos, Equals(Pos{"", 1, 1}))
+}
+
+func TestBadEscapesAreErrors(t *testing.T) {
+    AssertThat(t, tokenizeError(t, `"ab\qc"`).Pos, Equals(Pos{"", 1, 4}))
+    AssertThat(t, tokenizeError(t, `"\u{zz}"`).Kind, Equals(READ_ERROR))
+    AssertThat(t, tokenizeError(t, `"\u{D800}"`).Kind, Equals(READ_ERROR))
+    AssertThat(t, tokenizeError(t, `"\u{41"`).Kind, Equals(READ_ERROR))
+}
+
+func TestLineCommentsAreSkipped(t *testing.T) {
+    AssertThat(t, tokenize(t, "; leading\n(a ; (b c)\n d) ; trailing"), HasExactly(HasExactly(symbol("a"), symbol("d"))))
+}
+
+func TestLineCommentsEndSymbols(t *testing.T) {
+    AssertThat(t, tokenize(t, "abc;def"), HasExactly(symbol("abc")))
+}
+
+func TestBlockCommentsNest(t *testing.T) {
+    AssertThat(t, tokenize(t, "(a #| b #| c |# (d |# e)"), HasExactly(HasExactly(symbol("a"), symbol("e"))))
+}
+
+func TestUnterminatedBlockCommentsAreErrors(t *testing.T) {
+    AssertThat(t, tokenizeError(t, "(a\n #| b #| c |#)").Pos, Equals(Pos{"", 2, 2}))
+}
+
+func TestDatumCommentsSkipOneForm(t *testing.T) {
+    AssertThat(t, tokenize(t, "(a #;(b c) d #; e f)"), HasExactly(HasExactly(symbol("a"), symbol("d"), symbol("f"))))
+    AssertThat(t, tokenize(t, "(a #;#;b c d)"), HasExactly(HasExactly(symbol("a"), symbol("d"))))
+}
+
+func TestDatumCommentsNeedAForm(t *testing.T) {
+    AssertThat(t, tokenizeError(t, "(a #;)").Kind, Equals(READ_ERROR))
+}
+
+func TestCommentsKeepPositionsRight(t *testing.T) {
+    AssertThat(t, PositionIn(tokenize(t, "#| x\n y |# ; z\n  w"), 0), Equals(Pos{"", 3, 3}))
+}
+
+func TestStrayCloseParensAreErrors(t *testing.T) {
+    err := tokenizeError(t, "(a b))\n(c)")
+    AssertThat(t, err.Kind, Equals(READ_ERROR))
+    AssertThat(t, err.Pos, Equals(Pos{"", 1, 6}))
+    AssertThat(t, tokenizeError(t, ")").Pos, Equals(Pos{"", 1, 1}))
+}
+
+func TestUnclosedParensReportTheUnmatchedParen(t *testing.T) {
+    err := tokenizeError(t, "(a\n  (b (c)\n  d)")
+    AssertThat(t, err.Kind, Equals(INCOMPLETE_ERROR))
+    AssertThat(t, err.Pos, Equals(Pos{"", 1, 1}))
+    AssertThat(t, tokenizeError(t, "(a (b (c)").Pos, Equals(Pos{"", 1, 4}))
+}
+
+func TestIncompleteInputIsDistinguishable(t *testing.T) {
+    for _, input := range []string{"(a", "'", "\"abc", "#| abc", "(a #;", "`(a ,"} {
+        _, err := TokenizeString(input)
+        AssertThat(t, IsIncomplete(err), IsTrue)
+    }
+    for _, input := range []string{"a)", "(a ')", "(#;)", "\"\\q\""} {
+        _, err := TokenizeString(input)
+        AssertThat(t, IsIncomplete(err), IsFalse)
+    }
+}
+
+func TestReaderYieldsOneFormAtATime(t *testing.T) {
+    r := NewReader(iotest.OneByteReader(strings.NewReader("(a b) c\n 'd")), "")
+    form, err := r.Read()
+    AssertThat(t, form, HasExactly(symbol("a"), symbol("b")))
+    form, err = r.Read()
+    AssertThat(t, form, Equals(symbol("c")))
+    form, err = r.Read()
+    AssertThat(t, form, HasExactly(symbol("quote"), symbol("d")))
+    _, err = r.Read()
+    AssertThat(t, err, Equals(io.EOF))
+}
+
+func TestReaderDoesNotWaitForMoreInputThanItNeeds(t *testing.T) {
+    pr, pw := io.Pipe()
+    r := NewReader(pr, "stream")
+    go pw.Write([]byte("(first form)"))
+    form, err := r.Read()
+    if err != nil {
+        t.Fatal(err)
+    }
+    AssertThat(t, form, HasExactly(symbol("first"), symbol("form")))
+    go func() {
+        pw.Write([]byte(" (second)"))
+        pw.Close()
+    }()
+    form, err = r.Read()
+    AssertThat(t, form, HasExactly(symbol("second")))
+    AssertThat(t, PositionOf(form), Equals(Pos{"stream", 1, 15}))
+}
+
+func TestReaderReportsErrorsAndCarriesOn(t *testing.T) {
+    r := NewReader(strings.NewReader("a ) b"), "")
+    r.Read()
+    _, err := r.Read()
+    AssertThat(t, err.(*Error).Kind, Equals(READ_ERROR))
+    form, _ := r.Read()
+    AssertThat(t, form, Equals(symbol("b")))
+}
+
+func TestReaderReportsIncompleteForms(t *testing.T) {
+    r := NewReader(strings.NewReader("(a"), "")
+    _, err := r.Read()
+    AssertThat(t, IsIncomplete(err), IsTrue)
+}
+
+func TestReaderPassesOnIOErrors(t *testing.T) {
+    r := NewReader(iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("(a b)"))), "")
+    _, err := r.Read()
+    AssertThat(t, err, Equals(iotest.ErrTimeout))
+}
+
+func TestTokenizeFileReportsMissingFiles(t *testing.T) {
+    if _, err := TokenizeFile("/no/such/file.glisp"); err == nil {
+        t.Errorf("Expected an error for a missing file")
+    }
+}
+
+func TestReadsDottedPairs(t *testing.T) {
+    pair, ok := tokenize(t, "(a . 1)")[0].(*Pair)
+    AssertThat(t, ok, IsTrue)
+    AssertThat(t, pair.Car(), Equals(symbol("a")))
+    AssertThat(t, pair.Cdr(), Equals(int64(1)))
+}
+
+func TestReadsImproperLists(t *testing.T) {
+    AssertThat(t, Write(tokenize(t, "(1 2 . 3)")[0]), Equals("(1 2 . 3)"))
+    AssertThat(t, Write(tokenize(t, "((a . b) . (c . d))")[0]), Equals("((a . b) c . d)"))
+}
+
+func TestDottedListEndingInAListIsAList(t *testing.T) {
+    AssertThat(t, tokenize(t, "(1 . (2 3))"), HasExactly(HasExactly(int64(1), int64(2), int64(3))))
+}
+
+func TestMisplacedDotsAreReadErrors(t *testing.T) {
+    AssertThat(t, tokenizeError(t, "( . a)").Kind, Equals(READ_ERROR))
+    AssertThat(t, tokenizeError(t, "(a . )").Kind, Equals(READ_ERROR))
+    AssertThat(t, tokenizeError(t, "(a . b c)").Kind, Equals(READ_ERROR))
+    AssertThat(t, tokenizeError(t, "(a . b").Kind, Equals(INCOMPLETE_ERROR))
+    AssertThat(t, tokenizeError(t, "(a .").Kind, Equals(INCOMPLETE_ERROR))
+}
+
+func TestDotsInsideAtomsAreNotDots(t *testing.T) {
+    AssertThat(t, tokenize(t, "(a ... .5)"), HasExactly(HasExactly(symbol("a"), symbol("..."), 0.5)))
+}
+
+func TestDeeplyNestedSourceIsAReadErrorNotACrash(t *testing.T) {
+    for _, src := range []string{strings.Repeat("(", 5000000), strings.Repeat("'", 5000000) + "x", strings.Repeat("#;", 5000000) + "x"} {
+        err := tokenizeError(t, src)
+        AssertThat(t, err.Kind, Equals(READ_ERROR))
+    }
+    nested := strings.Repeat("(", 100) + strings.Repeat(")", 100)
+    _, err := TokenizeString(nested)
+    AssertThat(t, err, Equals(nil))
 }